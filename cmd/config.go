@@ -57,7 +57,9 @@ func LoadConfig() error {
 		v.SetDefault("logging.min_disk_space_required", 500) // Example default in MB
 
 		// Example: LOG_GENERATOR__HTTP_RESPONSE_WEIGHTS__RESPONSE_200
-		config.ManuallyLoadEnvVariables(v, "LOG_GENERATOR")
+		if err = config.LoadEnvVariables(v, "LOG_GENERATOR"); err != nil {
+			return
+		}
 
 		var cfg Config
 		if err = v.Unmarshal(&cfg); err == nil {
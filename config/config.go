@@ -3,11 +3,13 @@ package config
 import (
 	"bytes"
 	_ "embed"
+	"fmt"
 	"os"
 	"reflect"
 	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -17,34 +19,253 @@ import (
 var defaultYAML []byte
 
 type ConsoleOutputConfig struct {
-	Label      string `mapstructure:"label"`       // Label for the handler when reporting logging stats
-	Enabled    bool   `mapstructure:"enabled"`     // Enable or disable console output
-	JSONOutput bool   `mapstructure:"json_object"` // If true, output JSON objects; disables colors
-	Colors     bool   `mapstructure:"colors"`      // Enable color-coded logs (ignored if JSONOutput is true)
+	Label      string      `mapstructure:"label"`       // Label for the handler when reporting logging stats
+	Enabled    bool        `mapstructure:"enabled"`     // Enable or disable console output
+	Route      RouteConfig `mapstructure:"route"`       // Rules selecting which records are sent to this output
+	JSONOutput bool        `mapstructure:"json_object"` // If true, output JSON objects; disables colors
+	Colors     bool        `mapstructure:"colors"`      // Enable color-coded logs (ignored if JSONOutput is true)
 }
 
 type FileOutputConfig struct {
-	Label       string `mapstructure:"label"`         // Label for the handler when reporting logging stats
-	Enabled     bool   `mapstructure:"enabled"`       // Enable or disable file output
-	FilePath    string `mapstructure:"file_path"`     // Path to the log file
-	MaxFileSize int    `mapstructure:"max_file_size"` // Max file size in MB
-	MaxBackups  int    `mapstructure:"max_backups"`   // Number of backups to retain
-	MaxAgeDays  int    `mapstructure:"max_age_days"`  // Maximum age of log files in days
+	Label       string             `mapstructure:"label"`         // Label for the handler when reporting logging stats
+	Enabled     bool               `mapstructure:"enabled"`       // Enable or disable file output
+	Route       RouteConfig        `mapstructure:"route"`         // Rules selecting which records are sent to this output
+	FilePath    string             `mapstructure:"file_path"`     // Path to the log file
+	MaxFileSize int                `mapstructure:"max_file_size"` // Max file size in MB
+	MaxBackups  int                `mapstructure:"max_backups"`   // Number of backups to retain
+	MaxAgeDays  int                `mapstructure:"max_age_days"`  // Maximum age of log files in days
+	Rotation    FileRotationConfig `mapstructure:"rotation"`      // When and how to rotate the log file
+	Reopen      FileReopenConfig   `mapstructure:"reopen"`        // When to reopen the log file after it is moved by an external tool
+	FileMode    string             `mapstructure:"file_mode"`     // Permissions for new log files, in octal
+	DirMode     string             `mapstructure:"dir_mode"`      // Permissions for parent directories created when missing, in octal
+	Owner       string             `mapstructure:"owner"`         // User name or ID to own new log files and directories
+	Group       string             `mapstructure:"group"`         // Group name or ID to own new log files and directories
+}
+
+type FileReopenConfig struct {
+	Signal        string        `mapstructure:"signal"`         // Signal on which to reopen the log file, one of SIGHUP (unless Rotation.OnSIGHUP is set), SIGUSR1 or SIGUSR2
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often to check whether the log file was moved or truncated; 0 disables
+}
+
+type FileRotationConfig struct {
+	Mode        string        `mapstructure:"mode"`        // One of size (max_file_size only), interval or schedule
+	Interval    time.Duration `mapstructure:"interval"`    // For interval mode, time between rotations, aligned to the start of the day
+	Schedule    string        `mapstructure:"schedule"`    // For schedule mode, a cron expression such as "0 * * * *" or descriptor such as "@daily"
+	OnSIGHUP    bool          `mapstructure:"on_sighup"`   // Also rotate whenever the process receives SIGHUP
+	Compression string        `mapstructure:"compression"` // Compression for rotated files: gzip, zstd or none
+	TimeFormat  string        `mapstructure:"time_format"` // Go time layout for the timestamp in rotated file names
+	LocalTime   bool          `mapstructure:"local_time"`  // Use local time rather than UTC for file names and schedules
+
+	PostRotate func(rotatedPath string) `mapstructure:"-"` // Called with the path of each rotated file once it has been compressed
+	OnError    func(err error)          `mapstructure:"-"` // Called with any error rotating on SIGHUP, or compressing or cleaning up rotated files
 }
 type SyslogOutputConfig struct {
-	Label      string `mapstructure:"label"`       // Label for the handler when reporting logging stats
-	Enabled    bool   `mapstructure:"enabled"`     // Enable or disable syslog output
-	Network    string `mapstructure:"network"`     // Network over which to connect to syslog, default empty for local daemon
-	Addr       string `mapstructure:"addr"`        // Address of remote syslog server, if any
-	JSONOutput bool   `mapstructure:"json_object"` // If true, output JSON objects
+	Label      string      `mapstructure:"label"`       // Label for the handler when reporting logging stats
+	Enabled    bool        `mapstructure:"enabled"`     // Enable or disable syslog output
+	Route      RouteConfig `mapstructure:"route"`       // Rules selecting which records are sent to this output
+	Network    string      `mapstructure:"network"`     // Network over which to connect to syslog, default empty for local daemon
+	Addr       string      `mapstructure:"addr"`        // Address of remote syslog server, if any
+	JSONOutput bool        `mapstructure:"json_object"` // If true, output JSON objects
+}
+
+type JournaldOutputConfig struct {
+	Label      string      `mapstructure:"label"`       // Label for the handler when reporting logging stats
+	Enabled    bool        `mapstructure:"enabled"`     // Enable or disable journald output
+	Route      RouteConfig `mapstructure:"route"`       // Rules selecting which records are sent to this output
+	SocketPath string      `mapstructure:"socket_path"` // Path to the journald native protocol socket
+	Identifier string      `mapstructure:"identifier"`  // SYSLOG_IDENTIFIER to tag entries with, default the executable name
+	AddSource  bool        `mapstructure:"add_source"`  // If true, record CODE_FILE, CODE_LINE and CODE_FUNC for each entry
+}
+
+type NetworkOutputConfig struct {
+	Label          string        `mapstructure:"label"`           // Label for the handler when reporting logging stats
+	Enabled        bool          `mapstructure:"enabled"`         // Enable or disable network output
+	Route          RouteConfig   `mapstructure:"route"`           // Rules selecting which records are sent to this output
+	Network        string        `mapstructure:"network"`         // One of tcp, udp, unix (stream) or unixgram (datagram)
+	Addr           string        `mapstructure:"addr"`            // Address of the remote collector, or socket path for unix networks
+	Framing        string        `mapstructure:"framing"`         // One of newline, octet_counted or length_prefixed
+	DialTimeout    time.Duration `mapstructure:"dial_timeout"`    // Timeout when (re)connecting to the collector
+	WriteTimeout   time.Duration `mapstructure:"write_timeout"`   // Timeout for writing a single record
+	ReconnectDelay time.Duration `mapstructure:"reconnect_delay"` // Minimum time between reconnection attempts
+	TLS            TLSConfig     `mapstructure:"tls"`             // TLS settings, for tcp connections only
+}
+
+type BatchConfig struct {
+	MaxBatchSize  int           `mapstructure:"max_batch_size"` // Maximum number of records delivered in a single batch
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // Deliver a partial batch after this long
+	QueueSize     int           `mapstructure:"queue_size"`     // Maximum number of undelivered records to buffer before dropping
+	MaxRetries    int           `mapstructure:"max_retries"`    // Number of times to retry a failed batch
+	RetryBackoff  time.Duration `mapstructure:"retry_backoff"`  // Delay before the first retry, doubled for each further retry
+}
+
+type FluentdOutputConfig struct {
+	Label        string        `mapstructure:"label"`         // Label for the handler when reporting logging stats
+	Enabled      bool          `mapstructure:"enabled"`       // Enable or disable fluentd forward output
+	Route        RouteConfig   `mapstructure:"route"`         // Rules selecting which records are sent to this output
+	Network      string        `mapstructure:"network"`       // Network over which to reach the forward input, tcp or unix
+	Addr         string        `mapstructure:"addr"`          // Address of the fluentd/fluent-bit forward input
+	Tag          string        `mapstructure:"tag"`           // Tag to send each record with
+	TagKey       string        `mapstructure:"tag_key"`       // If set, records with a string attribute of this name use it as their tag
+	RequireAck   bool          `mapstructure:"require_ack"`   // Request and wait for an acknowledgement of each chunk
+	AckTimeout   time.Duration `mapstructure:"ack_timeout"`   // How long to wait for an acknowledgement before retrying
+	DialTimeout  time.Duration `mapstructure:"dial_timeout"`  // Timeout when (re)connecting to the forward input
+	WriteTimeout time.Duration `mapstructure:"write_timeout"` // Timeout for writing a single chunk
+	Batch        BatchConfig   `mapstructure:"batch"`         // Batching and retry settings
+	TLS          TLSConfig     `mapstructure:"tls"`           // TLS settings, for tcp connections only
+}
+
+type ElasticsearchOutputConfig struct {
+	Label          string        `mapstructure:"label"`           // Label for the handler when reporting logging stats
+	Enabled        bool          `mapstructure:"enabled"`         // Enable or disable Elasticsearch output
+	Route          RouteConfig   `mapstructure:"route"`           // Rules selecting which records are sent to this output
+	Addresses      []string      `mapstructure:"addresses"`       // Elasticsearch node URLs
+	Index          string        `mapstructure:"index"`           // Index or data stream to write to; may contain a date pattern such as %{+yyyy.MM.dd}
+	DataStream     bool          `mapstructure:"data_stream"`     // If true, Index names a data stream; records are written with @timestamp via "create"
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // Timeout for each bulk request
+	Batch          BatchConfig   `mapstructure:"batch"`           // Batching and retry settings
+}
+
+type OTLPOutputConfig struct {
+	Label          string            `mapstructure:"label"`           // Label for the handler when reporting logging stats
+	Enabled        bool              `mapstructure:"enabled"`         // Enable or disable OTLP output
+	Route          RouteConfig       `mapstructure:"route"`           // Rules selecting which records are sent to this output
+	Endpoint       string            `mapstructure:"endpoint"`        // Full URL of the collector's OTLP/HTTP logs endpoint
+	Protocol       string            `mapstructure:"protocol"`        // Encoding to export with, http/protobuf or http/json
+	Headers        map[string]string `mapstructure:"headers"`         // Additional headers to send with each export request
+	Compression    string            `mapstructure:"compression"`     // Request compression, gzip or none
+	RequestTimeout time.Duration     `mapstructure:"request_timeout"` // Timeout for each export request
+	Batch          BatchConfig       `mapstructure:"batch"`           // Batching and retry settings
+	TLS            TLSConfig         `mapstructure:"tls"`             // TLS settings for https endpoints
+}
+
+type HTTPOutputConfig struct {
+	Label          string            `mapstructure:"label"`           // Label for the handler when reporting logging stats
+	Enabled        bool              `mapstructure:"enabled"`         // Enable or disable HTTP output
+	Route          RouteConfig       `mapstructure:"route"`           // Rules selecting which records are sent to this output
+	URL            string            `mapstructure:"url"`             // URL to POST batches of records to
+	Encoder        string            `mapstructure:"encoder"`         // Request body format: json, loki or splunk_hec
+	Headers        map[string]string `mapstructure:"headers"`         // Additional headers to send with each request
+	TokenFile      string            `mapstructure:"token_file"`      // File containing a token to send in the Authorization header
+	AuthScheme     string            `mapstructure:"auth_scheme"`     // Scheme for the token, e.g. Bearer, or Splunk for HEC
+	Compression    string            `mapstructure:"compression"`     // Request compression, gzip or none
+	RequestTimeout time.Duration     `mapstructure:"request_timeout"` // Timeout for each request
+	MaxInFlight    int               `mapstructure:"max_in_flight"`   // Maximum number of requests in flight at once
+	Batch          BatchConfig       `mapstructure:"batch"`           // Batching and retry settings
+	TLS            TLSConfig         `mapstructure:"tls"`             // TLS settings for https URLs
+	Loki           LokiEncoderConfig `mapstructure:"loki"`            // Settings for the loki encoder
+	Splunk         SplunkHECConfig   `mapstructure:"splunk"`          // Settings for the splunk_hec encoder
+}
+
+type LokiEncoderConfig struct {
+	Labels       []string          `mapstructure:"labels"`        // Record attributes to use as stream labels, by dotted path through groups
+	StaticLabels map[string]string `mapstructure:"static_labels"` // Fixed labels added to every stream
+}
+
+type SplunkHECConfig struct {
+	Index      string `mapstructure:"index"`      // Index to send events to (default the token's index)
+	Source     string `mapstructure:"source"`     // Source reported for each event
+	SourceType string `mapstructure:"sourcetype"` // Sourcetype reported for each event
+	Host       string `mapstructure:"host"`       // Host reported for each event (default the hostname)
+}
+
+type QueueOutputConfig struct {
+	Label        string      `mapstructure:"label"`         // Label for the handler when reporting logging stats
+	Enabled      bool        `mapstructure:"enabled"`       // Enable or disable message queue output
+	Route        RouteConfig `mapstructure:"route"`         // Rules selecting which records are sent to this output
+	Type         string      `mapstructure:"type"`          // Kind of message queue to publish to, currently only kafka
+	KeyAttribute string      `mapstructure:"key_attribute"` // Record attribute used as the message key, to choose a partition
+	Batch        BatchConfig `mapstructure:"batch"`         // Batching and retry settings
+	Kafka        KafkaConfig `mapstructure:"kafka"`         // Settings for the kafka queue type
+}
+
+type KafkaConfig struct {
+	Brokers        []string      `mapstructure:"brokers"`         // Bootstrap brokers, as host:port
+	Topic          string        `mapstructure:"topic"`           // Topic to publish records to
+	ClientID       string        `mapstructure:"client_id"`       // Client ID reported to the brokers
+	RequiredAcks   string        `mapstructure:"required_acks"`   // Acknowledgments to wait for: none, leader or all
+	Compression    string        `mapstructure:"compression"`     // Record batch compression: none, gzip, snappy or zstd
+	DialTimeout    time.Duration `mapstructure:"dial_timeout"`    // Timeout for connecting to a broker
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // Timeout for each request, including waiting for acks
+	TLS            TLSConfig     `mapstructure:"tls"`             // TLS settings for broker connections
+}
+
+type OutputConfig struct {
+	Type     string         `mapstructure:"type"`    // Name the output type was registered under
+	Label    string         `mapstructure:"label"`   // Label for the handler when reporting logging stats (default the type)
+	Level    string         `mapstructure:"level"`   // Minimum level of records to send to this output (default INFO)
+	Route    RouteConfig    `mapstructure:"route"`   // Rules selecting which records are sent to this output
+	Settings map[string]any `mapstructure:",remain"` // Any other keys, passed to the output's factory
+}
+
+// RouteConfig selects the records sent to an output. A record is sent if it matches
+// any of the include rules (or there are none), and none of the exclude rules
+type RouteConfig struct {
+	Include []RouteRule `mapstructure:"include"` // Rules of which a record must match one to be sent
+	Exclude []RouteRule `mapstructure:"exclude"` // Rules of which a record must match none to be sent
+}
+
+// RouteRule matches records on every condition that is set
+type RouteRule struct {
+	MinLevel   string   `mapstructure:"min_level"`  // Lowest level to match
+	MaxLevel   string   `mapstructure:"max_level"`  // Highest level to match
+	Message    string   `mapstructure:"message"`    // Regular expression the message must match
+	Attributes []string `mapstructure:"attributes"` // Attributes the record must have, as "key" or "key=value"; grouped keys are dotted
+	Group      string   `mapstructure:"group"`      // Logger group (dotted for nested groups) the record must be logged within
+}
+
+type ServiceConfig struct {
+	Name               string            `mapstructure:"name"`                // Logical name of the service, reported as service.name
+	Version            string            `mapstructure:"version"`             // Version of the service, reported as service.version
+	Environment        string            `mapstructure:"environment"`         // Deployment environment, reported as deployment.environment
+	ResourceAttributes map[string]string `mapstructure:"resource_attributes"` // Any additional attributes describing the service
 }
 
 type HealthCheckConfig struct {
-	Enabled                  bool          `mapstructure:"enabled"`
-	LogPeriodicity           time.Duration `mapstructure:"log_periodicity"`
-	ElasticsearchPeriodicity time.Duration `mapstructure:"elasticsearch_periodicity"`
-	ElasticsearchIndex       string        `mapstructure:"elasticsearch_index"`
-	ElasticsearchURL         string        `mapstructure:"elasticsearch_url"`
+	Enabled                     bool                  `mapstructure:"enabled"`
+	Backend                     string                `mapstructure:"backend"` // Where heartbeats are looked up: elasticsearch, opensearch, loki, file, or a registered backend
+	LogPeriodicity              time.Duration         `mapstructure:"log_periodicity"`
+	ElasticsearchPeriodicity    time.Duration         `mapstructure:"elasticsearch_periodicity"`
+	DegradedAfter               time.Duration         `mapstructure:"degraded_after"`         // Lag of the latest heartbeat at which the pipeline is degraded; 0 to never be
+	DownAfter                   time.Duration         `mapstructure:"down_after"`             // Lag of the latest heartbeat at which the pipeline is down; 0 to never be
+	MaxConsecutiveErrors        int                   `mapstructure:"max_consecutive_errors"` // Records (or, for batching outputs, batches) in a row an output may fail to handle before the logger is unhealthy; 0 to ignore output errors
+	ElasticsearchIndex          string                `mapstructure:"elasticsearch_index"`
+	Message                     string                `mapstructure:"message"`          // Message of the heartbeat records
+	TimestampField              string                `mapstructure:"timestamp_field"`  // Search field holding each heartbeat's timestamp
+	InstanceField               string                `mapstructure:"instance_field"`   // Search field holding the logger instance UUID, matched exactly
+	MessageField                string                `mapstructure:"message_field"`    // Search field holding the message, matched exactly
+	TimestampFormat             string                `mapstructure:"timestamp_format"` // Format of the timestamp field: auto, rfc3339, epoch_millis or epoch_nanos
+	ElasticsearchURL            string                `mapstructure:"elasticsearch_url"`
+	ElasticsearchAddresses      []string              `mapstructure:"elasticsearch_addresses"`       // Further Elasticsearch node URLs, tried in turn alongside ElasticsearchURL
+	ElasticsearchCloudID        string                `mapstructure:"elasticsearch_cloud_id"`        // Elastic Cloud deployment ID; if set, the URL and addresses are ignored
+	ElasticsearchUsername       string                `mapstructure:"elasticsearch_username"`        // User for basic authentication, if any
+	ElasticsearchPassword       Secret                `mapstructure:"elasticsearch_password"`        // Password for basic authentication, or a secret reference
+	ElasticsearchAPIKey         Secret                `mapstructure:"elasticsearch_api_key"`         // Base64-encoded API key, or a secret reference; takes precedence over basic authentication
+	ElasticsearchTLS            TLSConfig             `mapstructure:"elasticsearch_tls"`             // TLS settings, such as a CA file, client certificate or skipping verification
+	ElasticsearchRequestTimeout time.Duration         `mapstructure:"elasticsearch_request_timeout"` // Timeout for each query, including retries; 0 for none
+	Loki                        LokiHealthCheckConfig `mapstructure:"loki"`                          // Settings for the loki backend
+	File                        FileHealthCheckConfig `mapstructure:"file"`                          // Settings for the file backend
+}
+
+type LokiHealthCheckConfig struct {
+	URL            string        `mapstructure:"url"`             // Base URL of Loki, such as http://loki:3100
+	Selector       string        `mapstructure:"selector"`        // LogQL stream selector matching the logger's streams
+	TenantID       string        `mapstructure:"tenant_id"`       // Tenant sent in the X-Scope-OrgID header, if any
+	Username       string        `mapstructure:"username"`        // User for basic authentication, if any
+	Password       Secret        `mapstructure:"password"`        // Password for basic authentication, or a secret reference
+	TLS            TLSConfig     `mapstructure:"tls"`             // TLS settings for https URLs
+	Lookback       time.Duration `mapstructure:"lookback"`        // How far back to search for the latest heartbeat
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // Timeout for each query; 0 for none
+}
+
+type FileHealthCheckConfig struct {
+	Path      string `mapstructure:"path"`       // Log file to read heartbeats back from; defaults to file_output.file_path
+	TailBytes int64  `mapstructure:"tail_bytes"` // How much of the end of the file to search
+}
+
+type MetricsConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`        // Serve Prometheus metrics of the logger's statistics on ListenAddress
+	ListenAddress string `mapstructure:"listen_address"` // Address of the admin HTTP listener serving the metrics and /healthz; empty for none
+	Path          string `mapstructure:"path"`           // Path the admin listener serves the metrics on
 }
 
 type SequenceConfig struct {
@@ -53,54 +274,161 @@ type SequenceConfig struct {
 	SequenceKey string `mapstructure:"sequence_key"`  // The key to log the logger's message sequence number under
 }
 type Config struct {
-	LogLevel      string              `mapstructure:"log_level"`      // Log level (e.g., DEBUG, INFO, WARN, ERROR)
-	ConsoleOutput ConsoleOutputConfig `mapstructure:"console_output"` // Console output settings
-	FileOutput    FileOutputConfig    `mapstructure:"file_output"`    // File output settings
-	SyslogOutput  SyslogOutputConfig  `mapstructure:"syslog_output"`  // Syslog output settings
-	HealthCheck   HealthCheckConfig   `mapstructure:"health_check"`   // Health Check Settings
-	SequenceInfo  SequenceConfig      `mapstructure:"sequence_info"`  // Include info about sequence of log message
+	LogLevel            string                    `mapstructure:"log_level"`            // Log level (e.g., DEBUG, INFO, WARN, ERROR)
+	Service             ServiceConfig             `mapstructure:"service"`              // Description of the service doing the logging
+	ConsoleOutput       ConsoleOutputConfig       `mapstructure:"console_output"`       // Console output settings
+	FileOutput          FileOutputConfig          `mapstructure:"file_output"`          // File output settings
+	SyslogOutput        SyslogOutputConfig        `mapstructure:"syslog_output"`        // Syslog output settings
+	JournaldOutput      JournaldOutputConfig      `mapstructure:"journald_output"`      // Journald output settings
+	NetworkOutput       NetworkOutputConfig       `mapstructure:"network_output"`       // Network output settings
+	FluentdOutput       FluentdOutputConfig       `mapstructure:"fluentd_output"`       // Fluentd forward protocol output settings
+	ElasticsearchOutput ElasticsearchOutputConfig `mapstructure:"elasticsearch_output"` // Elasticsearch bulk output settings
+	OTLPOutput          OTLPOutputConfig          `mapstructure:"otlp_output"`          // OpenTelemetry OTLP/HTTP output settings
+	HTTPOutput          HTTPOutputConfig          `mapstructure:"http_output"`          // HTTP/webhook output settings
+	QueueOutput         QueueOutputConfig         `mapstructure:"queue_output"`         // Message queue output settings
+	Outputs             []OutputConfig            `mapstructure:"outputs"`              // Additional outputs, by registered type
+	HealthCheck         HealthCheckConfig         `mapstructure:"health_check"`         // Health Check Settings
+	SequenceInfo        SequenceConfig            `mapstructure:"sequence_info"`        // Include info about sequence of log message
+	Metrics             MetricsConfig             `mapstructure:"metrics"`              // Prometheus metrics settings
 }
 
 // LoadConfig loads and merges the configuration in this order:
 // 1. Defaults from default.yaml (embedded).
-// 2. Configurations from a file (if provided).
-// 3. Environment variables (LOGGER_ prefix).
-// 4. Overrides provided programmatically.
-func LoadConfig(configFile string, overrides *Config) (*Config, error) {
+// 2. The system-wide config file and drop-in directory in DefaultLayers, or those set by Layers.
+// 3. Configurations from a file (if provided).
+// 4. Environment variables (LOGGER__ prefix), as described in env.go.
+// 5. Overrides provided programmatically: non-zero fields of overrides, then any
+// Override options, which may also set fields to false or zero.
+//
+// Config files may be YAML, JSON or TOML, detected from their extension.
+// The merged configuration is checked with Validate before it is returned
+func LoadConfig(configFile string, overrides *Config, options ...LoadOption) (*Config, error) {
+	opts := loadOptions{layers: DefaultLayers}
+	for _, option := range options {
+		option.applyLoadOption(&opts)
+	}
+	files, err := layerFiles(opts.layers, configFile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.strict {
+		if err := checkUnknownKeys(files, "LOGGER"); err != nil {
+			return nil, err
+		}
+	}
+
 	v := viper.New()
+	tracker := layerTracker{}
+	layerOrder := []string{"defaults"}
 
 	// Load embedded default.yaml
 	v.SetConfigType("yaml")
 	if err := v.ReadConfig(bytes.NewReader(defaultYAML)); err != nil {
 		return nil, err
 	}
+	tracker.record(v.AllKeys(), "defaults")
 
-	// Load from config file if provided
-	if configFile != "" {
-		v.SetConfigFile(configFile)
-		if err := v.MergeInConfig(); err != nil {
+	// Merge each config file in turn, with later files taking precedence
+	for _, file := range files {
+		fileViper, err := readConfigFile(file)
+		if err != nil {
 			return nil, err
 		}
+		if err := v.MergeConfigMap(fileViper.AllSettings()); err != nil {
+			return nil, err
+		}
+		tracker.record(fileViper.AllKeys(), file)
+		layerOrder = append(layerOrder, file)
 	}
 
-	// Manually load environment variables
-	ManuallyLoadEnvVariables(v, "LOGGER")
+	// Load environment variables, including indexed list elements
+	if err := loadEnvVariables(v, "LOGGER"); err != nil {
+		return nil, err
+	}
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if key, ok := envViperKey(name, "LOGGER__"); ok {
+			tracker.record([]string{key}, "env "+name)
+			layerOrder = append(layerOrder, "env "+name)
+		}
+	}
 
 	// Parse into Config struct
 	config := &Config{}
 	if err := v.Unmarshal(config); err != nil {
 		return nil, err
 	}
+	var beforeOverrides map[string]any
+	if opts.provenance != nil {
+		beforeOverrides = map[string]any{}
+		flattenConfig(reflect.ValueOf(config).Elem(), "", beforeOverrides)
+	}
 
 	// Apply overrides if provided
 	if overrides != nil {
 		ApplyOverrides(config, overrides)
 	}
+	for _, override := range opts.overrides {
+		override(config)
+	}
 
+	if opts.provenance != nil {
+		opts.provenance.build(config, beforeOverrides, tracker, layerOrder)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadOption changes how LoadConfig loads the configuration
+type LoadOption interface {
+	applyLoadOption(*loadOptions)
+}
+
+type loadOptions struct {
+	strict     bool        // Reject unknown keys
+	overrides  []Override  // Applied in order after the other layers
+	layers     []string    // Config files and directories loaded before the config file
+	provenance *Provenance // If set, filled in with the source of each setting
+}
+
+type loadOptionFunc func(*loadOptions)
+
+func (f loadOptionFunc) applyLoadOption(opts *loadOptions) { f(opts) }
+
+// Strict makes LoadConfig reject keys in the config file or LOGGER__ environment
+// variables that do not name any setting, rather than silently ignoring them
+func Strict() LoadOption {
+	return loadOptionFunc(func(opts *loadOptions) { opts.strict = true })
+}
+
+// Override is a LoadOption that modifies the loaded configuration directly.
+// Unlike the overrides passed to LoadConfig, it can set fields to false or zero,
+// such as to disable an output that default.yaml enables
+type Override func(*Config)
+
+func (o Override) applyLoadOption(opts *loadOptions) {
+	opts.overrides = append(opts.overrides, o)
+}
+
+// DefaultConfig returns the configuration from the embedded default.yaml alone,
+// without any config file, environment variables or overrides applied
+func DefaultConfig() (*Config, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(defaultYAML)); err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
 // ApplyOverrides dynamically applies non-zero override values to a config, including nested structs.
+// Zero values cannot be told apart from unset fields, so are skipped; use an Override to set them.
 func ApplyOverrides(config, overrides interface{}) {
 	// Get reflection values of the structs
 	overrideVal := reflect.ValueOf(overrides).Elem()
@@ -121,25 +449,53 @@ func ApplyOverrides(config, overrides interface{}) {
 	}
 }
 
-// ManuallyLoadEnvVariables scans and loads all environment variables with the given prefix into Viper.
-func ManuallyLoadEnvVariables(v *viper.Viper, prefix string) {
-	prefix = strings.ToUpper(prefix) + "__" // Ensure prefix is uppercase
-
-	for _, env := range os.Environ() {
-		parts := strings.SplitN(env, "=", 2)
-		key, value := parts[0], parts[1]
-
-		if strings.HasPrefix(key, prefix) {
-			// Remove the prefix
-			keyWithoutPrefix := strings.TrimPrefix(key, prefix)
+// DecodeSettings decodes the output's type-specific settings into target, which
+// should be a pointer to a struct with mapstructure tags. Settings are converted
+// the same way as the rest of the configuration, so durations may be given as strings
+func (o OutputConfig) DecodeSettings(target any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           target,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(o.Settings); err != nil {
+		return fmt.Errorf("invalid settings for %s output: %w", o.Type, err)
+	}
+	return nil
+}
 
-			// Convert key to Viper-compatible format:
-			// - Replace "__" with "." for nested structures
-			// - Convert to lowercase (Viper's default behavior)
-			viperKey := strings.ToLower(strings.ReplaceAll(keyWithoutPrefix, "__", "."))
+// LoadEnvVariables scans and loads all environment variables with the given prefix into Viper.
+// Variables whose values do not suit their setting in Config are skipped, and reported
+// in the returned *ValidationError, which names each variable; the others are still loaded.
+func LoadEnvVariables(v *viper.Viper, prefix string) error {
+	return loadEnvVariables(v, prefix)
+}
 
-			v.Set(viperKey, value)
+// ManuallyLoadEnvVariables scans and loads all environment variables with the given prefix into Viper.
+// Variables whose values do not suit their setting are skipped.
+//
+// Deprecated: Use LoadEnvVariables, which reports the skipped variables.
+func ManuallyLoadEnvVariables(v *viper.Viper, prefix string) {
+	_ = loadEnvVariables(v, prefix)
+}
 
-		}
+// envViperKey converts the name of an environment variable with the given
+// (uppercase, "__"-terminated) prefix to the Viper key it sets
+func envViperKey(key, prefix string) (string, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
 	}
+	// Remove the prefix
+	keyWithoutPrefix := strings.TrimPrefix(key, prefix)
+
+	// Convert key to Viper-compatible format:
+	// - Replace "__" with "." for nested structures
+	// - Convert to lowercase (Viper's default behavior)
+	return strings.ToLower(strings.ReplaceAll(keyWithoutPrefix, "__", ".")), true
 }
@@ -0,0 +1,215 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Environment variables name a setting by its path in the config file, in upper case,
+// with "__" between each level:
+//
+//	LOGGER__FILE_OUTPUT__MAX_BACKUPS=10
+//
+// Lists of values may be given comma-separated, or one element at a time by index:
+//
+//	LOGGER__ELASTICSEARCH_OUTPUT__ADDRESSES=https://es1:9200,https://es2:9200
+//	LOGGER__ELASTICSEARCH_OUTPUT__ADDRESSES__0=https://es1:9200
+//
+// Lists of sections, such as outputs, are set one field at a time by index. Fields
+// set this way are merged into the list from the config files:
+//
+//	LOGGER__OUTPUTS__0__TYPE=file
+//	LOGGER__OUTPUTS__0__FILE_PATH=/var/log/chtc/audit.log
+//
+// Maps are set one key at a time. Keys are lower-cased:
+//
+//	LOGGER__SERVICE__RESOURCE_ATTRIBUTES__REGION=us-central
+//
+// Values are checked against the type of their setting, with errors naming the variable.
+
+// Number of elements a list may be extended by past its current length when set by
+// index, so that a mistyped index can't allocate a huge list. Variables are loaded in
+// name order, which puts index 10 before index 2
+const maxEnvListGrowth = 64
+
+// loadEnvVariables loads each environment variable with the given prefix into v,
+// returning a *ValidationError for any whose value does not suit its setting
+func loadEnvVariables(v *viper.Viper, prefix string) error {
+	prefix = strings.ToUpper(prefix) + "__"
+	invalid := &validator{}
+	configType := reflect.TypeOf(Config{})
+
+	env := os.Environ()
+	slices.Sort(env)
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		key, ok := envViperKey(name, prefix)
+		if !ok {
+			continue
+		}
+		path := strings.Split(key, ".")
+		setting, listAt, known := resolveSetting(configType, path)
+		if known {
+			if err := checkEnvValue(setting, value); err != nil {
+				invalid.addf(key, "invalid value %q set by environment variable %s: %v", value, name, err)
+				continue
+			}
+		}
+		// Unknown keys are set as before, to be rejected in strict mode
+		if listAt < 0 {
+			v.Set(key, value)
+			continue
+		}
+		listKey := strings.Join(path[:listAt], ".")
+		updated, err := setPath(v.Get(listKey), path[listAt:], value)
+		if err != nil {
+			invalid.addf(key, "invalid environment variable %s: %v", name, err)
+			continue
+		}
+		v.Set(listKey, updated)
+	}
+	return invalid.err()
+}
+
+// resolveSetting finds the type of the setting at path within the config struct type t,
+// and the position in path of the first list index, or -1 if there is none. The type
+// is nil for settings that accept any value, such as the settings of an output
+func resolveSetting(t reflect.Type, path []string) (setting reflect.Type, listAt int, ok bool) {
+	listAt = -1
+	for i, segment := range path {
+		switch t.Kind() {
+		case reflect.Struct:
+			field, found, remain := settingField(t, segment)
+			if remain {
+				return nil, listAt, true
+			} else if !found {
+				return nil, listAt, false
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Slice:
+			if index, err := strconv.Atoi(segment); err != nil || index < 0 {
+				return nil, listAt, false
+			}
+			if listAt < 0 {
+				listAt = i
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return nil, listAt, true
+		default:
+			return nil, listAt, false
+		}
+	}
+	if t.Kind() == reflect.Interface {
+		return nil, listAt, true
+	}
+	return t, listAt, true
+}
+
+// settingField finds the field of a config struct with the given mapstructure name.
+// remain is true if there is no such field, but the struct collects unknown keys
+func settingField(t reflect.Type, name string) (field reflect.StructField, found, remain bool) {
+	for i := 0; i < t.NumField(); i++ {
+		tag, opts, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if tag == name && tag != "" && tag != "-" {
+			return t.Field(i), true, false
+		}
+		remain = remain || (tag == "" && opts == "remain")
+	}
+	return reflect.StructField{}, false, remain
+}
+
+// checkEnvValue checks that value can be converted to the setting's type
+func checkEnvValue(setting reflect.Type, value string) error {
+	if setting == nil {
+		return nil
+	}
+	var err error
+	switch setting.Kind() {
+	case reflect.Bool:
+		_, err = strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if setting == reflect.TypeOf(time.Duration(0)) {
+			_, err = time.ParseDuration(value)
+		} else {
+			_, err = strconv.ParseInt(value, 0, setting.Bits())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err = strconv.ParseUint(value, 0, setting.Bits())
+	case reflect.Float32, reflect.Float64:
+		_, err = strconv.ParseFloat(value, setting.Bits())
+	case reflect.Slice:
+		// Comma-separated elements
+		for _, element := range strings.Split(value, ",") {
+			if err = checkEnvValue(setting.Elem(), element); err != nil {
+				break
+			}
+		}
+	case reflect.Struct, reflect.Map:
+		err = fmt.Errorf("a section cannot be set directly; set each of its fields instead")
+	}
+	return err
+}
+
+// setPath returns a copy of node, a value decoded from a config file, with the value at
+// path set. Numeric segments index lists, which are extended as needed, by at most
+// maxEnvListGrowth elements past their current length
+func setPath(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if index, err := strconv.Atoi(path[0]); err == nil {
+		list, _ := node.([]any)
+		if index > len(list)+maxEnvListGrowth {
+			return nil, fmt.Errorf("list index %d is too far past the end of the list, which has %d elements", index, len(list))
+		}
+		list = slices.Clone(list)
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		element, err := setPath(list[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = element
+		return list, nil
+	}
+	section := map[string]any{}
+	if existing, ok := node.(map[string]any); ok {
+		maps.Copy(section, existing)
+	}
+	element, err := setPath(section[path[0]], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	section[path[0]] = element
+	return section, nil
+}
@@ -0,0 +1,105 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package config
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Ensure that lists, indexed list elements and maps can be set by environment variables,
+// with indexed elements merged into the list from the config file
+func TestEnvListsAndMaps(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"app.yaml": `
+outputs:
+  - type: file
+    label: audit
+    file_path: /var/log/chtc/audit.log
+`})
+	t.Setenv("LOGGER__OUTPUTS__0__LEVEL", "WARN")
+	t.Setenv("LOGGER__OUTPUTS__1__TYPE", "syslog")
+	t.Setenv("LOGGER__OUTPUTS__1__ROUTE__INCLUDE__0__MIN_LEVEL", "ERROR")
+	t.Setenv("LOGGER__ELASTICSEARCH_OUTPUT__ADDRESSES", "https://es1:9200,https://es2:9200")
+	t.Setenv("LOGGER__SERVICE__RESOURCE_ATTRIBUTES__REGION", "us-central")
+	t.Setenv("LOGGER__FILE_OUTPUT__ROTATION__INTERVAL", "1h")
+
+	cfg, err := LoadConfig(path.Join(dir, "app.yaml"), nil, Layers(), Strict())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.Outputs) != 2 {
+		t.Fatalf("Expected 2 outputs, got %+v", cfg.Outputs)
+	}
+	audit, syslog := cfg.Outputs[0], cfg.Outputs[1]
+	if audit.Type != "file" || audit.Label != "audit" || audit.Level != "WARN" || audit.Settings["file_path"] != "/var/log/chtc/audit.log" {
+		t.Errorf("Expected the level to be merged into the output from the config file, got %+v", audit)
+	}
+	if syslog.Type != "syslog" || len(syslog.Route.Include) != 1 || syslog.Route.Include[0].MinLevel != "ERROR" {
+		t.Errorf("Expected a second output from the environment, got %+v", syslog)
+	}
+	if addresses := cfg.ElasticsearchOutput.Addresses; !reflect.DeepEqual(addresses, []string{"https://es1:9200", "https://es2:9200"}) {
+		t.Errorf("Expected comma-separated addresses, got %v", addresses)
+	}
+	if region := cfg.Service.ResourceAttributes["region"]; region != "us-central" {
+		t.Errorf("Expected the region resource attribute, got %q", region)
+	}
+	if interval := cfg.FileOutput.Rotation.Interval; interval != time.Hour {
+		t.Errorf("Expected a rotation interval of 1h, got %v", interval)
+	}
+}
+
+// Ensure that values that do not suit their setting are reported with the variable's name
+func TestEnvInvalidValues(t *testing.T) {
+	t.Setenv("LOGGER__FILE_OUTPUT__MAX_BACKUPS", "five")
+	t.Setenv("LOGGER__CONSOLE_OUTPUT__COLORS", "maybe")
+	t.Setenv("LOGGER__FILE_OUTPUT__REOPEN__CHECK_INTERVAL", "10")
+	t.Setenv("LOGGER__FILE_OUTPUT__ROTATION", "daily")
+	t.Setenv("LOGGER__OUTPUTS__1000000000__TYPE", "file")
+
+	_, err := LoadConfig("", nil, Layers())
+	expected := []string{"console_output.colors", "file_output.max_backups", "file_output.reopen.check_interval", "file_output.rotation", "outputs.1000000000.type"}
+	if paths := invalidPaths(t, err); !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected invalid settings %v, got %v", expected, paths)
+	}
+	if !strings.Contains(err.Error(), `file_output.max_backups: invalid value "five" set by environment variable LOGGER__FILE_OUTPUT__MAX_BACKUPS`) {
+		t.Errorf("Expected the error to name the environment variable, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "LOGGER__OUTPUTS__1000000000__TYPE: list index 1000000000 is too far past the end") {
+		t.Errorf("Expected the error to name the variable with the out of range index, got %v", err)
+	}
+
+	// Callers loading the variables themselves are given the same errors
+	err = LoadEnvVariables(viper.New(), "LOGGER")
+	if paths := invalidPaths(t, err); !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected invalid settings %v from LoadEnvVariables, got %v", expected, paths)
+	}
+
+	// The deprecated loader still skips the invalid variables, without reporting them
+	t.Setenv("LOGGER__FILE_OUTPUT__MAX_FILE_SIZE", "20")
+	v := viper.New()
+	ManuallyLoadEnvVariables(v, "LOGGER")
+	if v.GetInt("file_output.max_file_size") != 20 || v.IsSet("file_output.max_backups") {
+		t.Errorf("Expected only the valid variables to be loaded, got %v", v.AllSettings())
+	}
+}
@@ -0,0 +1,178 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultLayers are the system-wide config file and drop-in directory loaded
+// before the application's config file. Either may be missing
+var DefaultLayers = []string{"/etc/chtc/logger.yaml", "/etc/chtc/logger.d"}
+
+// Extensions of the config files loaded from a drop-in directory
+var configExtensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+// Layers replaces DefaultLayers with the given config files and drop-in directories,
+// loaded in order before the application's config file. Files in a directory are
+// loaded in lexical order. Layers that do not exist are skipped
+func Layers(paths ...string) LoadOption {
+	return loadOptionFunc(func(opts *loadOptions) { opts.layers = paths })
+}
+
+// layerFiles lists the config files to load, in order: those found in layers,
+// followed by configFile, which must exist if set
+func layerFiles(layers []string, configFile string) ([]string, error) {
+	var files []string
+	for _, layer := range layers {
+		info, err := os.Stat(layer)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, layer)
+			continue
+		}
+		entries, err := os.ReadDir(layer)
+		if err != nil {
+			return nil, err
+		}
+		// ReadDir returns entries sorted by name
+		for _, entry := range entries {
+			if !entry.IsDir() && slices.Contains(configExtensions, filepath.Ext(entry.Name())) {
+				files = append(files, filepath.Join(layer, entry.Name()))
+			}
+		}
+	}
+	if configFile != "" {
+		files = append(files, configFile)
+	}
+	return files, nil
+}
+
+// readConfigFile reads a single config file, with its format detected from its extension
+func readConfigFile(file string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %w", file, err)
+	}
+	return v, nil
+}
+
+// Provenance records the layer that set each effective setting loaded by LoadConfig
+type Provenance struct {
+	Sources []Source // Sorted by key
+}
+
+// Source describes where the effective value of a setting came from
+type Source struct {
+	Key   string // Dotted key, such as file_output.max_backups
+	Value any    // Effective value
+	Layer string // "defaults", a config file path, "env " and a variable name, or "overrides"
+}
+
+// RecordProvenance makes LoadConfig fill in p with the source of each setting
+func RecordProvenance(p *Provenance) LoadOption {
+	return loadOptionFunc(func(opts *loadOptions) { opts.provenance = p })
+}
+
+// Dump writes each setting, its value and the layer that set it, one per line
+func (p *Provenance) Dump(w io.Writer) error {
+	for _, source := range p.Sources {
+		if _, err := fmt.Fprintf(w, "%s = %v (%s)\n", source.Key, source.Value, source.Layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tracks the last layer to set each Viper key while loading the configuration
+type layerTracker map[string]string
+
+func (t layerTracker) record(keys []string, layer string) {
+	for _, key := range keys {
+		t[key] = layer
+	}
+}
+
+// layerOf returns the last layer to set key, or any setting within it
+func (t layerTracker) layerOf(key string, order map[string]int) string {
+	layer, found := t[key]
+	for tracked, trackedLayer := range t {
+		if strings.HasPrefix(tracked, key+".") && (!found || order[trackedLayer] > order[layer]) {
+			layer, found = trackedLayer, true
+		}
+	}
+	return layer
+}
+
+// flattenConfig maps the dotted key of each setting in a config struct to its value.
+// Maps and lists are treated as single settings
+func flattenConfig(val reflect.Value, prefix string, settings map[string]any) {
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := joinPath(prefix, tag)
+		if field.Type.Kind() == reflect.Struct {
+			flattenConfig(val.Field(i), key, settings)
+		} else {
+			settings[key] = val.Field(i).Interface()
+		}
+	}
+}
+
+// build fills in the provenance of cfg from the layers recorded by tracker, with
+// settings that changed between before and cfg attributed to the overrides
+func (p *Provenance) build(cfg *Config, before map[string]any, tracker layerTracker, layers []string) {
+	order := make(map[string]int, len(layers))
+	for i, layer := range layers {
+		order[layer] = i
+	}
+	settings := map[string]any{}
+	flattenConfig(reflect.ValueOf(cfg).Elem(), "", settings)
+
+	p.Sources = p.Sources[:0]
+	for key, value := range settings {
+		layer := tracker.layerOf(key, order)
+		if !reflect.DeepEqual(before[key], value) {
+			layer = "overrides"
+		} else if layer == "" {
+			continue
+		}
+		p.Sources = append(p.Sources, Source{Key: key, Value: value, Layer: layer})
+	}
+	sort.Slice(p.Sources, func(i, j int) bool { return p.Sources[i].Key < p.Sources[j].Key })
+}
@@ -0,0 +1,93 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package config
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("Failed to create config directory: %v", err)
+		}
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+}
+
+// Ensure that a system-wide file, drop-in fragments of each format and an application
+// file are merged in order, and that the provenance of each setting is recorded
+func TestLayeredConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"logger.yaml":             "log_level: WARN\nfile_output:\n  max_backups: 10\n  max_age_days: 7\n",
+		"logger.d/10-file.json":   `{"file_output": {"max_backups": 20, "file_path": "/var/log/chtc/pool.log"}}`,
+		"logger.d/20-syslog.toml": "[syslog_output]\nenabled = true\nlabel = \"pool\"\n",
+		"logger.d/README":         "ignored",
+		"app.yaml":                "file_output:\n  max_backups: 30\n",
+	})
+	t.Setenv("LOGGER__FILE_OUTPUT__MAX_AGE_DAYS", "3")
+
+	var provenance Provenance
+	cfg, err := LoadConfig(path.Join(dir, "app.yaml"), &Config{SyslogOutput: SyslogOutputConfig{Label: "schedd"}},
+		Layers(path.Join(dir, "logger.yaml"), path.Join(dir, "logger.d"), path.Join(dir, "missing.d")),
+		RecordProvenance(&provenance))
+	if err != nil {
+		t.Fatalf("Failed to load layered config: %v", err)
+	}
+	if cfg.LogLevel != "WARN" || cfg.FileOutput.FilePath != "/var/log/chtc/pool.log" || cfg.FileOutput.MaxBackups != 30 ||
+		cfg.FileOutput.MaxAgeDays != 3 || !cfg.SyslogOutput.Enabled || cfg.SyslogOutput.Label != "schedd" {
+		t.Fatalf("Layers were not merged in order: %+v", cfg)
+	}
+
+	expected := map[string]string{
+		"log_level":                path.Join(dir, "logger.yaml"),
+		"file_output.file_path":    path.Join(dir, "logger.d/10-file.json"),
+		"syslog_output.enabled":    path.Join(dir, "logger.d/20-syslog.toml"),
+		"file_output.max_backups":  path.Join(dir, "app.yaml"),
+		"file_output.max_age_days": "env LOGGER__FILE_OUTPUT__MAX_AGE_DAYS",
+		"syslog_output.label":      "overrides",
+		"console_output.enabled":   "defaults",
+	}
+	layers := map[string]string{}
+	for _, source := range provenance.Sources {
+		layers[source.Key] = source.Layer
+	}
+	for key, layer := range expected {
+		if layers[key] != layer {
+			t.Errorf("Expected %s to be set by %s, got %q", key, layer, layers[key])
+		}
+	}
+	var dump bytes.Buffer
+	if err := provenance.Dump(&dump); err != nil || !strings.Contains(dump.String(), "file_output.max_backups = 30 ("+path.Join(dir, "app.yaml")+")\n") {
+		t.Errorf("Expected the dump to list each setting, got %v:\n%s", err, dump.String())
+	}
+
+	// Unknown keys are reported in every layer
+	writeConfigFiles(t, dir, map[string]string{"logger.d/30-typo.toml": "[file_output]\nmax_backup = 1\n"})
+	_, err = LoadConfig("", nil, Layers(path.Join(dir, "logger.d")), Strict())
+	if err == nil || !strings.Contains(err.Error(), "file_output.max_backup: unknown key in "+path.Join(dir, "logger.d/30-typo.toml")) {
+		t.Errorf("Expected the unknown key in the drop-in file to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KubernetesSecretsDir is the directory under which k8s: secret references are read,
+// with each Kubernetes secret mounted as a volume in a directory named after it
+var KubernetesSecretsDir = "/var/run/secrets/chtc"
+
+// Shown in place of a secret's value
+const redacted = "[redacted]"
+
+// Secret is a credential, given either directly or as a reference to where it is kept:
+//
+//	file:///var/run/secrets/es-password  the contents of a file
+//	env:ES_TOKEN                         the value of an environment variable
+//	k8s:elasticsearch/password           the password key of the elasticsearch secret,
+//	                                     mounted under KubernetesSecretsDir
+//
+// References are resolved each time the secret is used, so rotated credentials are
+// picked up. A Secret's value is never printed, logged or marshaled
+type Secret string
+
+// Resolve returns the secret's value, reading it from the place it references
+func (s Secret) Resolve() (string, error) {
+	ref := string(s)
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		return readSecretFile(strings.TrimPrefix(ref, "file://"))
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "k8s:"):
+		name, key, ok := strings.Cut(strings.TrimPrefix(ref, "k8s:"), "/")
+		if !ok || !filepath.IsLocal(name) || !filepath.IsLocal(key) {
+			return "", fmt.Errorf("kubernetes secret reference %s is not of the form k8s:<secret>/<key>", ref)
+		}
+		return readSecretFile(filepath.Join(KubernetesSecretsDir, name, key))
+	}
+	return ref, nil
+}
+
+// Reads a secret from a file, without the trailing newline editors tend to add
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// IsReference reports whether the secret refers to a file, environment variable or
+// Kubernetes secret rather than holding its value directly
+func (s Secret) IsReference() bool {
+	for _, prefix := range []string{"file://", "env:", "k8s:"} {
+		if strings.HasPrefix(string(s), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// String redacts the secret, so it is not exposed by fmt or in dumped config
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// LogValue redacts the secret when it is logged
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// MarshalText redacts the secret when the config is encoded
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
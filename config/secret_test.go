@@ -0,0 +1,95 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"testing"
+)
+
+// Ensure that each kind of secret reference is resolved
+func TestSecretResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"es-password":               "hunter2\n",
+		"k8s/elasticsearch/api-key": "a2V5",
+	})
+	KubernetesSecretsDir = path.Join(dir, "k8s")
+	t.Cleanup(func() { KubernetesSecretsDir = "/var/run/secrets/chtc" })
+	t.Setenv("ES_TOKEN", "token")
+	passwordFile := Secret("file://" + path.Join(dir, "es-password"))
+
+	for secret, expected := range map[Secret]string{
+		"plain":                     "plain",
+		passwordFile:                "hunter2",
+		"env:ES_TOKEN":              "token",
+		"k8s:elasticsearch/api-key": "a2V5",
+	} {
+		if value, err := secret.Resolve(); err != nil || value != expected {
+			t.Errorf("Expected %s to resolve to %q, got %q (%v)", string(secret), expected, value, err)
+		}
+	}
+	for _, secret := range []Secret{"file:///no/such/secret", "env:NO_SUCH_TOKEN", "k8s:elasticsearch", "k8s:../escape"} {
+		if _, err := secret.Resolve(); err == nil {
+			t.Errorf("Expected %s not to resolve", string(secret))
+		}
+	}
+}
+
+// Ensure that secrets are redacted wherever the config may be shown, and that
+// unresolvable references are reported without exposing any values
+func TestSecretRedaction(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"app.yaml": `
+health_check:
+  enabled: true
+  elasticsearch_url: https://es.example.org:9200
+  elasticsearch_username: elastic
+  elasticsearch_password: hunter2
+  elasticsearch_api_key: env:NO_SUCH_TOKEN
+`})
+	_, err := LoadConfig(path.Join(dir, "app.yaml"), nil, Layers())
+	if paths := invalidPaths(t, err); len(paths) != 1 || paths[0] != "health_check.elasticsearch_api_key" {
+		t.Fatalf("Expected the unresolvable API key to be reported, got %v", err)
+	}
+
+	var provenance Provenance
+	cfg, err := LoadConfig(path.Join(dir, "app.yaml"), nil, Layers(), RecordProvenance(&provenance),
+		Override(func(cfg *Config) { cfg.HealthCheck.ElasticsearchAPIKey = "" }))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	var shown bytes.Buffer
+	provenance.Dump(&shown)
+	fmt.Fprintf(&shown, "%v %+v", cfg, cfg.HealthCheck)
+	encoded, _ := json.Marshal(cfg.HealthCheck)
+	shown.Write(encoded)
+	slog.New(slog.NewJSONHandler(&shown, nil)).Info("config", "password", cfg.HealthCheck.ElasticsearchPassword)
+
+	if strings.Contains(shown.String(), "hunter2") || !strings.Contains(shown.String(), "[redacted]") {
+		t.Fatalf("Expected the password to be redacted, got:\n%s", shown.String())
+	}
+	if password, _ := cfg.HealthCheck.ElasticsearchPassword.Resolve(); password != "hunter2" {
+		t.Fatalf("Expected the password to resolve, got %q", password)
+	}
+}
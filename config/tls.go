@@ -0,0 +1,84 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type TLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`              // Enable or disable TLS for the connection
+	CAFile             string `mapstructure:"ca_file"`              // PEM file of CAs used to verify the server, or a secret reference to the PEM; default system roots
+	CertFile           string `mapstructure:"cert_file"`            // PEM client certificate, if the server requires one
+	KeyFile            string `mapstructure:"key_file"`             // PEM private key for the client certificate
+	ServerName         string `mapstructure:"server_name"`          // Override the server name used for verification
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip server certificate verification (testing only)
+}
+
+// ClientConfig builds a crypto/tls client configuration from the TLS settings.
+// Returns nil if TLS is not enabled
+func (t TLSConfig) ClientConfig() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		caPEM, err := t.readCA()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("TLS client certificate requires both cert_file and key_file")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// readCA reads the PEM CAs from CAFile, which may also be a secret reference such as
+// k8s:<secret>/ca.crt or env:VARIABLE, resolved to the PEM itself
+func (t TLSConfig) readCA() ([]byte, error) {
+	if ref := Secret(t.CAFile); ref.IsReference() {
+		caPEM, err := ref.Resolve()
+		return []byte(caPEM), err
+	}
+	return os.ReadFile(t.CAFile)
+}
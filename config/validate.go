@@ -0,0 +1,494 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// FieldError describes a single invalid setting
+type FieldError struct {
+	Path    string // YAML path of the setting, such as file_output.max_file_size
+	Message string // What is wrong with the setting
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every invalid setting found in a configuration
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+	return "invalid logger configuration: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual field errors, for use with errors.As
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Collects the errors found while validating a configuration
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.fields = append(v.fields, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validator) required(path, value string) {
+	if value == "" {
+		v.addf(path, "must be set")
+	}
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.addf(path, "%q is not one of %s", value, strings.Join(slices.DeleteFunc(allowed, func(s string) bool { return s == "" }), ", "))
+	}
+}
+
+func (v *validator) nonNegative(path string, value int64) {
+	if value < 0 {
+		v.addf(path, "must not be negative")
+	}
+}
+
+func (v *validator) positive(path string, value time.Duration) {
+	if value <= 0 {
+		v.addf(path, "must be a positive duration")
+	}
+}
+
+func (v *validator) level(path, value string) {
+	if value == "" {
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		v.addf(path, "%q is not a log level", value)
+	}
+}
+
+func (v *validator) url(path, value string) {
+	if value == "" {
+		v.addf(path, "must be set")
+	} else if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+		v.addf(path, "%q is not an absolute URL", value)
+	}
+}
+
+func (v *validator) fileMode(path, value string) {
+	if mode, err := strconv.ParseUint(value, 8, 32); value != "" && (err != nil || mode > 0o7777) {
+		v.addf(path, "%q is not an octal file mode", value)
+	}
+}
+
+// secret checks that a secret reference can be resolved, without revealing its value
+func (v *validator) secret(path string, value Secret) {
+	if _, err := value.Resolve(); err != nil {
+		v.addf(path, "%v", err)
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Validate checks the configuration for invalid settings, returning a *ValidationError
+// listing each of them by its YAML path. Settings of disabled outputs are not checked
+func (c *Config) Validate() error {
+	v := &validator{}
+	v.level("log_level", c.LogLevel)
+	if c.ConsoleOutput.Enabled {
+		validateRoute(v, "console_output.route", c.ConsoleOutput.Route)
+	}
+	if c.FileOutput.Enabled {
+		validateFileOutput(v, "file_output", c.FileOutput)
+	}
+	if c.SyslogOutput.Enabled {
+		validateSyslogOutput(v, "syslog_output", c.SyslogOutput)
+	}
+	if c.JournaldOutput.Enabled {
+		validateRoute(v, "journald_output.route", c.JournaldOutput.Route)
+	}
+	if c.NetworkOutput.Enabled {
+		validateNetworkOutput(v, "network_output", c.NetworkOutput)
+	}
+	if c.FluentdOutput.Enabled {
+		validateFluentdOutput(v, "fluentd_output", c.FluentdOutput)
+	}
+	if c.ElasticsearchOutput.Enabled {
+		validateElasticsearchOutput(v, "elasticsearch_output", c.ElasticsearchOutput)
+	}
+	if c.OTLPOutput.Enabled {
+		validateOTLPOutput(v, "otlp_output", c.OTLPOutput)
+	}
+	if c.HTTPOutput.Enabled {
+		validateHTTPOutput(v, "http_output", c.HTTPOutput)
+	}
+	if c.QueueOutput.Enabled {
+		validateQueueOutput(v, "queue_output", c.QueueOutput)
+	}
+	for i, output := range c.Outputs {
+		validateOutput(v, fmt.Sprintf("outputs[%d]", i), output)
+	}
+	v.nonNegative("health_check.max_consecutive_errors", int64(c.HealthCheck.MaxConsecutiveErrors))
+	if c.HealthCheck.Enabled {
+		validateHealthCheck(v, "health_check", c.HealthCheck, c.FileOutput)
+	}
+	if c.Metrics.Enabled && c.Metrics.ListenAddress != "" && !strings.HasPrefix(c.Metrics.Path, "/") {
+		v.addf("metrics.path", "%q must start with /", c.Metrics.Path)
+	}
+	if c.SequenceInfo.Enabled {
+		v.required("sequence_info.logger_id_key", c.SequenceInfo.IdKey)
+		v.required("sequence_info.sequence_key", c.SequenceInfo.SequenceKey)
+	}
+	return v.err()
+}
+
+// Validators for the settings of each built-in type in the outputs list, by type
+var builtinOutputValidators = map[string]func(v *validator, path string, output OutputConfig, defaults *Config){
+	"console": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		decodeOutputSettings(v, path, output, defaults.ConsoleOutput)
+	},
+	"file": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.FileOutput); ok {
+			validateFileOutput(v, path, settings)
+		}
+	},
+	"syslog": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.SyslogOutput); ok {
+			validateSyslogOutput(v, path, settings)
+		}
+	},
+	"journald": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		decodeOutputSettings(v, path, output, defaults.JournaldOutput)
+	},
+	"network": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.NetworkOutput); ok {
+			validateNetworkOutput(v, path, settings)
+		}
+	},
+	"fluentd": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.FluentdOutput); ok {
+			validateFluentdOutput(v, path, settings)
+		}
+	},
+	"elasticsearch": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.ElasticsearchOutput); ok {
+			validateElasticsearchOutput(v, path, settings)
+		}
+	},
+	"otlp": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.OTLPOutput); ok {
+			validateOTLPOutput(v, path, settings)
+		}
+	},
+	"http": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.HTTPOutput); ok {
+			validateHTTPOutput(v, path, settings)
+		}
+	},
+	"queue": func(v *validator, path string, output OutputConfig, defaults *Config) {
+		if settings, ok := decodeOutputSettings(v, path, output, defaults.QueueOutput); ok {
+			validateQueueOutput(v, path, settings)
+		}
+	},
+}
+
+func decodeOutputSettings[T any](v *validator, path string, output OutputConfig, settings T) (T, bool) {
+	if err := output.DecodeSettings(&settings); err != nil {
+		v.addf(path, "%v", err)
+		return settings, false
+	}
+	return settings, true
+}
+
+// validateOutput checks an entry in the outputs list. Only the settings of the
+// built-in types are known; those of registered types are checked by their factories
+func validateOutput(v *validator, path string, output OutputConfig) {
+	v.required(joinPath(path, "type"), output.Type)
+	v.level(joinPath(path, "level"), output.Level)
+	validateRoute(v, joinPath(path, "route"), output.Route)
+	if validate, ok := builtinOutputValidators[output.Type]; ok {
+		defaults, err := DefaultConfig()
+		if err != nil {
+			v.addf(path, "unable to load defaults: %v", err)
+			return
+		}
+		validate(v, path, output, defaults)
+	}
+}
+
+func validateRoute(v *validator, path string, route RouteConfig) {
+	for kind, rules := range map[string][]RouteRule{"include": route.Include, "exclude": route.Exclude} {
+		for i, rule := range rules {
+			rulePath := fmt.Sprintf("%s.%s[%d]", path, kind, i)
+			v.level(joinPath(rulePath, "min_level"), rule.MinLevel)
+			v.level(joinPath(rulePath, "max_level"), rule.MaxLevel)
+			if _, err := regexp.Compile(rule.Message); err != nil {
+				v.addf(joinPath(rulePath, "message"), "invalid message pattern: %v", err)
+			}
+			for j, attr := range rule.Attributes {
+				if key, _, _ := strings.Cut(attr, "="); key == "" {
+					v.addf(fmt.Sprintf("%s.attributes[%d]", rulePath, j), "%q does not name an attribute", attr)
+				}
+			}
+		}
+	}
+}
+
+func validateBatch(v *validator, path string, batch BatchConfig) {
+	v.nonNegative(joinPath(path, "max_batch_size"), int64(batch.MaxBatchSize))
+	v.nonNegative(joinPath(path, "flush_interval"), int64(batch.FlushInterval))
+	v.nonNegative(joinPath(path, "queue_size"), int64(batch.QueueSize))
+	v.nonNegative(joinPath(path, "max_retries"), int64(batch.MaxRetries))
+	v.nonNegative(joinPath(path, "retry_backoff"), int64(batch.RetryBackoff))
+}
+
+func validateTLS(v *validator, path string, tls TLSConfig) {
+	if tls.Enabled && (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.addf(path, "cert_file and key_file must be set together")
+	}
+	if ref := Secret(tls.CAFile); tls.Enabled && ref.IsReference() {
+		v.secret(joinPath(path, "ca_file"), ref)
+	}
+}
+
+func validateFileOutput(v *validator, path string, file FileOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), file.Route)
+	v.required(joinPath(path, "file_path"), file.FilePath)
+	v.nonNegative(joinPath(path, "max_file_size"), int64(file.MaxFileSize))
+	v.nonNegative(joinPath(path, "max_backups"), int64(file.MaxBackups))
+	v.nonNegative(joinPath(path, "max_age_days"), int64(file.MaxAgeDays))
+	v.fileMode(joinPath(path, "file_mode"), file.FileMode)
+	v.fileMode(joinPath(path, "dir_mode"), file.DirMode)
+
+	rotation := file.Rotation
+	v.oneOf(joinPath(path, "rotation.mode"), rotation.Mode, "", "size", "interval", "schedule")
+	switch rotation.Mode {
+	case "interval":
+		v.positive(joinPath(path, "rotation.interval"), rotation.Interval)
+	case "schedule":
+		if _, err := cron.ParseStandard(rotation.Schedule); err != nil {
+			v.addf(joinPath(path, "rotation.schedule"), "invalid schedule %q: %v", rotation.Schedule, err)
+		}
+	}
+	v.oneOf(joinPath(path, "rotation.compression"), rotation.Compression, "", "none", "gzip", "zstd")
+
+	if signal := strings.ToUpper(file.Reopen.Signal); signal != "" {
+		if !strings.HasPrefix(signal, "SIG") {
+			signal = "SIG" + signal
+		}
+		v.oneOf(joinPath(path, "reopen.signal"), signal, "SIGHUP", "SIGUSR1", "SIGUSR2")
+		if signal == "SIGHUP" && rotation.OnSIGHUP {
+			v.addf(joinPath(path, "reopen.signal"), "must not be SIGHUP when rotation.on_sighup is set, since the signal would both rotate and reopen the file")
+		}
+	}
+	v.nonNegative(joinPath(path, "reopen.check_interval"), int64(file.Reopen.CheckInterval))
+}
+
+func validateSyslogOutput(v *validator, path string, syslog SyslogOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), syslog.Route)
+	v.oneOf(joinPath(path, "network"), syslog.Network, "", "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram")
+	if syslog.Network != "" {
+		v.required(joinPath(path, "addr"), syslog.Addr)
+	}
+}
+
+func validateNetworkOutput(v *validator, path string, network NetworkOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), network.Route)
+	v.oneOf(joinPath(path, "network"), network.Network, "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram")
+	v.required(joinPath(path, "addr"), network.Addr)
+	v.oneOf(joinPath(path, "framing"), network.Framing, "newline", "octet_counted", "length_prefixed")
+	v.nonNegative(joinPath(path, "dial_timeout"), int64(network.DialTimeout))
+	v.nonNegative(joinPath(path, "write_timeout"), int64(network.WriteTimeout))
+	v.nonNegative(joinPath(path, "reconnect_delay"), int64(network.ReconnectDelay))
+	validateTLS(v, joinPath(path, "tls"), network.TLS)
+}
+
+func validateFluentdOutput(v *validator, path string, fluentd FluentdOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), fluentd.Route)
+	v.oneOf(joinPath(path, "network"), fluentd.Network, "tcp", "tcp4", "tcp6", "unix")
+	v.required(joinPath(path, "addr"), fluentd.Addr)
+	v.nonNegative(joinPath(path, "ack_timeout"), int64(fluentd.AckTimeout))
+	v.nonNegative(joinPath(path, "dial_timeout"), int64(fluentd.DialTimeout))
+	v.nonNegative(joinPath(path, "write_timeout"), int64(fluentd.WriteTimeout))
+	validateBatch(v, joinPath(path, "batch"), fluentd.Batch)
+	validateTLS(v, joinPath(path, "tls"), fluentd.TLS)
+}
+
+func validateElasticsearchOutput(v *validator, path string, es ElasticsearchOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), es.Route)
+	if len(es.Addresses) == 0 {
+		v.addf(joinPath(path, "addresses"), "must list at least one address")
+	}
+	for i, address := range es.Addresses {
+		v.url(fmt.Sprintf("%s.addresses[%d]", path, i), address)
+	}
+	v.required(joinPath(path, "index"), es.Index)
+	v.nonNegative(joinPath(path, "request_timeout"), int64(es.RequestTimeout))
+	validateBatch(v, joinPath(path, "batch"), es.Batch)
+}
+
+func validateOTLPOutput(v *validator, path string, otlp OTLPOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), otlp.Route)
+	v.url(joinPath(path, "endpoint"), otlp.Endpoint)
+	v.oneOf(joinPath(path, "protocol"), otlp.Protocol, "http/protobuf", "http/json")
+	v.oneOf(joinPath(path, "compression"), otlp.Compression, "", "none", "gzip")
+	v.nonNegative(joinPath(path, "request_timeout"), int64(otlp.RequestTimeout))
+	validateBatch(v, joinPath(path, "batch"), otlp.Batch)
+	validateTLS(v, joinPath(path, "tls"), otlp.TLS)
+}
+
+func validateHTTPOutput(v *validator, path string, http HTTPOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), http.Route)
+	v.url(joinPath(path, "url"), http.URL)
+	v.required(joinPath(path, "encoder"), http.Encoder)
+	v.oneOf(joinPath(path, "compression"), http.Compression, "", "none", "gzip")
+	v.nonNegative(joinPath(path, "request_timeout"), int64(http.RequestTimeout))
+	v.nonNegative(joinPath(path, "max_in_flight"), int64(http.MaxInFlight))
+	validateBatch(v, joinPath(path, "batch"), http.Batch)
+	validateTLS(v, joinPath(path, "tls"), http.TLS)
+}
+
+// Backends registered by the logger package beyond the built-in ones are not checked
+func validateHealthCheck(v *validator, path string, health HealthCheckConfig, fileOutput FileOutputConfig) {
+	v.positive(joinPath(path, "log_periodicity"), health.LogPeriodicity)
+	v.positive(joinPath(path, "elasticsearch_periodicity"), health.ElasticsearchPeriodicity)
+	v.oneOf(joinPath(path, "timestamp_format"), health.TimestampFormat, "", "auto", "rfc3339", "epoch_millis", "epoch_nanos")
+	v.nonNegative(joinPath(path, "degraded_after"), int64(health.DegradedAfter))
+	v.nonNegative(joinPath(path, "down_after"), int64(health.DownAfter))
+	if health.DegradedAfter > 0 && health.DownAfter > 0 && health.DownAfter < health.DegradedAfter {
+		v.addf(joinPath(path, "down_after"), "must not be less than degraded_after (%s)", health.DegradedAfter)
+	}
+	switch health.Backend {
+	case "", "elasticsearch", "opensearch":
+		v.required(joinPath(path, "elasticsearch_index"), health.ElasticsearchIndex)
+		if health.ElasticsearchCloudID == "" || health.Backend == "opensearch" {
+			if health.ElasticsearchURL == "" && len(health.ElasticsearchAddresses) == 0 {
+				v.addf(joinPath(path, "elasticsearch_url"), "must be set, unless elasticsearch_addresses or elasticsearch_cloud_id is")
+			} else if health.ElasticsearchURL != "" {
+				v.url(joinPath(path, "elasticsearch_url"), health.ElasticsearchURL)
+			}
+			for i, address := range health.ElasticsearchAddresses {
+				v.url(fmt.Sprintf("%s[%d]", joinPath(path, "elasticsearch_addresses"), i), address)
+			}
+		}
+		validateTLS(v, joinPath(path, "elasticsearch_tls"), health.ElasticsearchTLS)
+		v.nonNegative(joinPath(path, "elasticsearch_request_timeout"), int64(health.ElasticsearchRequestTimeout))
+		v.secret(joinPath(path, "elasticsearch_password"), health.ElasticsearchPassword)
+		v.secret(joinPath(path, "elasticsearch_api_key"), health.ElasticsearchAPIKey)
+	case "loki":
+		loki := health.Loki
+		v.url(joinPath(path, "loki.url"), loki.URL)
+		v.required(joinPath(path, "loki.selector"), loki.Selector)
+		v.nonNegative(joinPath(path, "loki.lookback"), int64(loki.Lookback))
+		v.nonNegative(joinPath(path, "loki.request_timeout"), int64(loki.RequestTimeout))
+		v.secret(joinPath(path, "loki.password"), loki.Password)
+		validateTLS(v, joinPath(path, "loki.tls"), loki.TLS)
+	case "file":
+		if health.File.Path == "" && fileOutput.FilePath == "" {
+			v.addf(joinPath(path, "file.path"), "is required when file_output.file_path is not set")
+		}
+		v.nonNegative(joinPath(path, "file.tail_bytes"), health.File.TailBytes)
+	}
+}
+
+func validateQueueOutput(v *validator, path string, queue QueueOutputConfig) {
+	validateRoute(v, joinPath(path, "route"), queue.Route)
+	v.oneOf(joinPath(path, "type"), queue.Type, "kafka")
+	validateBatch(v, joinPath(path, "batch"), queue.Batch)
+	if queue.Type == "kafka" {
+		kafka := queue.Kafka
+		if len(kafka.Brokers) == 0 {
+			v.addf(joinPath(path, "kafka.brokers"), "must list at least one broker")
+		}
+		v.required(joinPath(path, "kafka.topic"), kafka.Topic)
+		v.oneOf(joinPath(path, "kafka.required_acks"), kafka.RequiredAcks, "", "none", "leader", "all")
+		v.oneOf(joinPath(path, "kafka.compression"), kafka.Compression, "", "none", "gzip", "snappy", "zstd")
+		v.nonNegative(joinPath(path, "kafka.dial_timeout"), int64(kafka.DialTimeout))
+		v.nonNegative(joinPath(path, "kafka.request_timeout"), int64(kafka.RequestTimeout))
+		validateTLS(v, joinPath(path, "kafka.tls"), kafka.TLS)
+	}
+}
+
+// checkUnknownKeys returns a *ValidationError listing each key in the config files
+// and each environment variable with the given prefix that does not name a setting
+func checkUnknownKeys(files []string, prefix string) error {
+	v := &validator{}
+	configType := reflect.TypeOf(Config{})
+	knownKey := func(key string) bool {
+		_, _, known := resolveSetting(configType, strings.Split(key, "."))
+		return known
+	}
+	for _, file := range files {
+		fileViper, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		for _, key := range fileViper.AllKeys() {
+			if !knownKey(key) {
+				v.addf(key, "unknown key in %s", file)
+			}
+		}
+	}
+	prefix = strings.ToUpper(prefix) + "__"
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if key, ok := envViperKey(name, prefix); ok && !knownKey(key) {
+			v.addf(key, "unknown key set by environment variable %s", name)
+		}
+	}
+	slices.SortFunc(v.fields, func(a, b FieldError) int { return strings.Compare(a.Path, b.Path) })
+	return v.err()
+}
@@ -0,0 +1,138 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package config
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func invalidPaths(t *testing.T, err error) []string {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+	var paths []string
+	for _, field := range validationErr.Fields {
+		paths = append(paths, field.Path)
+	}
+	return paths
+}
+
+// Ensure that every invalid setting of the enabled outputs is reported by its YAML path
+func TestValidate(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("Failed to load default config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the default config to be valid, got %v", err)
+	}
+
+	cfg.LogLevel = "LOUD"
+	cfg.FileOutput.FilePath = ""
+	cfg.FileOutput.MaxBackups = -1
+	cfg.FileOutput.Rotation.Mode = "schedule"
+	cfg.FileOutput.Rotation.Schedule = "every hour"
+	cfg.FileOutput.Rotation.OnSIGHUP = true
+	cfg.FileOutput.Reopen.Signal = "hup"
+	cfg.SyslogOutput.Enabled = true
+	cfg.SyslogOutput.Network = "sctp"
+	cfg.NetworkOutput.Network = "sctp" // Disabled, so not checked
+	cfg.Outputs = []OutputConfig{
+		{Type: "file", Level: "WARN", Settings: map[string]any{"file_path": "/tmp/app.log", "max_file_size": -5}},
+		{Type: "custom", Level: "quiet", Settings: map[string]any{"anything": true}},
+		{Label: "typeless"},
+	}
+
+	expected := []string{
+		"log_level",
+		"file_output.file_path",
+		"file_output.max_backups",
+		"file_output.rotation.schedule",
+		"file_output.reopen.signal",
+		"syslog_output.network",
+		"syslog_output.addr",
+		"outputs[0].max_file_size",
+		"outputs[1].level",
+		"outputs[2].type",
+	}
+	if paths := invalidPaths(t, cfg.Validate()); !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected invalid settings %v, got %v", expected, paths)
+	}
+}
+
+// Ensure that only the settings of the chosen health check backend are checked
+func TestValidateHealthCheckBackend(t *testing.T) {
+	cfg, err := DefaultConfig()
+	if err != nil {
+		t.Fatalf("Failed to load default config: %v", err)
+	}
+	cfg.HealthCheck.Enabled = true
+	cfg.HealthCheck.ElasticsearchURL = "not a url"
+	cfg.HealthCheck.ElasticsearchTLS = TLSConfig{Enabled: true, CAFile: "env:CHTC_TEST_NO_SUCH_CA"}
+	cfg.FileOutput.FilePath = ""
+	for backend, expected := range map[string][]string{
+		"elasticsearch": {"file_output.file_path", "health_check.elasticsearch_url", "health_check.elasticsearch_tls.ca_file"},
+		"loki":          {"file_output.file_path", "health_check.loki.url"},
+		"file":          {"file_output.file_path", "health_check.file.path"},
+		"custom":        {"file_output.file_path"},
+	} {
+		cfg.HealthCheck.Backend = backend
+		if paths := invalidPaths(t, cfg.Validate()); !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expected invalid settings %v for the %s backend, got %v", expected, backend, paths)
+		}
+	}
+}
+
+// Ensure that LoadConfig validates the merged configuration, and that strict mode
+// rejects unknown keys in the config file and environment variables
+func TestLoadConfigStrict(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "logger.yaml")
+	content := `
+log_level: DEBUG
+file_output:
+  file_path: /tmp/app.log
+  max_fil_size: 10
+outputs:
+  - type: custom
+    anything: true
+`
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("LOGGER__CONSOLE_OUTPUT__COLOURS", "false")
+
+	if _, err := LoadConfig(configFile, nil); err != nil {
+		t.Fatalf("Expected unknown keys to be ignored outside of strict mode, got %v", err)
+	}
+	_, err := LoadConfig(configFile, nil, Strict())
+	expected := []string{"console_output.colours", "file_output.max_fil_size"}
+	if paths := invalidPaths(t, err); !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected unknown keys %v, got %v", expected, paths)
+	}
+
+	t.Setenv("LOGGER__LOG_LEVEL", "LOUD")
+	_, err = LoadConfig("", nil)
+	if paths := invalidPaths(t, err); !reflect.DeepEqual(paths, []string{"log_level"}) {
+		t.Fatalf("Expected the log level from the environment to be rejected, got %v", paths)
+	}
+}
@@ -0,0 +1,327 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Function that delivers a batch of records to a remote sink
+type batchSender[T any] func(ctx context.Context, batch []T) error
+
+// ErrPermanent matches delivery failures that should not be retried, with errors.Is.
+// Senders such as QueueSink implementations mark an error as permanent with Permanent,
+// or by wrapping ErrPermanent themselves
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Permanent marks err as a delivery failure that should not be retried
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Error wrapper for delivery failures that should not be retried
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentError) Unwrap() error {
+	return p.err
+}
+
+func (p permanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// Error returned by a sender that delivered only part of a batch. Records in
+// retry may be sent again, while failed counts records that were rejected outright
+type partialFailure[T any] struct {
+	retry  []T
+	failed int
+	err    error
+}
+
+func (p *partialFailure[T]) Error() string {
+	return p.err.Error()
+}
+
+func (p *partialFailure[T]) Unwrap() error {
+	return p.err
+}
+
+// BatchStats reports delivery statistics for a handler that sends records in batches
+type BatchStats struct {
+	// Number of batches in which every record was delivered
+	BatchesSucceeded uint64
+	// Number of batches in which at least one record could not be delivered
+	BatchesFailed uint64
+	// Total number of records delivered
+	RecordsSucceeded uint64
+	// Total number of records that could not be delivered, after retries
+	RecordsFailed uint64
+	// Total number of records dropped because the delivery queue was full
+	RecordsDropped uint64
+	// Number of records currently queued for delivery
+	Queued int
+	// Time at which the most recent batch with at least one delivered record was sent
+	LastDelivered time.Time
+	// Number of batches in a row of which no record could be delivered
+	ConsecutiveFailedBatches int
+	// Most recent delivery error, and the time at which it occurred
+	LastDeliveryError     error
+	LastDeliveryErrorTime time.Time
+}
+
+// Interface for handlers that deliver records in batches and can report their delivery statistics
+type BatchStatsReporter interface {
+	BatchStats() BatchStats
+}
+
+// batcher buffers records in memory and delivers them to a sink from a background
+// goroutine, either once a full batch has accumulated or on a fixed interval.
+// Failed deliveries are retried with exponential backoff; errors from batches
+// that could not be delivered are handed back to the next caller of add, so that
+// they can be attributed to the handler that owns the batcher
+type batcher[T any] struct {
+	opts config.BatchConfig
+	send batchSender[T]
+
+	// Limits the number of batches being delivered at once
+	inFlight   chan struct{}
+	deliveries sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []T
+	errs    []error
+	stats   BatchStats
+
+	flush  chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+	once   sync.Once
+}
+
+// newBatcher constructs a batcher that delivers one batch at a time, in order
+func newBatcher[T any](opts config.BatchConfig, send batchSender[T]) *batcher[T] {
+	return newConcurrentBatcher(opts, 1, send)
+}
+
+// newConcurrentBatcher constructs a batcher that delivers up to maxInFlight
+// batches at once. The sender must be safe for concurrent use
+func newConcurrentBatcher[T any](opts config.BatchConfig, maxInFlight int, send batchSender[T]) *batcher[T] {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 1
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	b := &batcher[T]{
+		opts:     opts,
+		send:     send,
+		inFlight: make(chan struct{}, maxInFlight),
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues a single record for delivery, returning any delivery errors that
+// have occurred since the previous call
+func (b *batcher[T]) add(item T) error {
+	b.mu.Lock()
+	var errs []error
+	if b.closed {
+		errs = append(errs, errors.New("batching handler is closed"))
+	} else if b.opts.QueueSize > 0 && len(b.pending) >= b.opts.QueueSize {
+		b.stats.RecordsDropped++
+		errs = append(errs, fmt.Errorf("delivery queue is full (%d records), dropping record", b.opts.QueueSize))
+	} else {
+		b.pending = append(b.pending, item)
+	}
+	full := len(b.pending) >= b.opts.MaxBatchSize
+	errs = append(errs, b.errs...)
+	b.errs = nil
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flush <- struct{}{}:
+		default:
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// batchStats returns a snapshot of the batcher's delivery statistics
+func (b *batcher[T]) batchStats() BatchStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Queued = len(b.pending)
+	return stats
+}
+
+// close delivers any records that are still queued, then stops the background goroutine
+func (b *batcher[T]) close() error {
+	b.once.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		close(b.stop)
+		<-b.done
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := errors.Join(b.errs...)
+	b.errs = nil
+	return err
+}
+
+func (b *batcher[T]) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			// Drain whatever is left, without waiting on retry backoff
+			for b.deliverNext(false) {
+			}
+			b.deliveries.Wait()
+			return
+		case <-ticker.C:
+			for b.deliverNext(true) {
+			}
+		case <-b.flush:
+			for b.deliverNext(true) {
+			}
+		}
+	}
+}
+
+// deliverNext waits for a free delivery slot, then takes up to one batch from
+// the queue and delivers it in the background. Returns whether there may be
+// more records waiting
+func (b *batcher[T]) deliverNext(retry bool) bool {
+	b.inFlight <- struct{}{}
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		<-b.inFlight
+		return false
+	}
+	size := min(len(b.pending), b.opts.MaxBatchSize)
+	batch := b.pending[:size:size]
+	b.pending = b.pending[size:]
+	b.mu.Unlock()
+
+	b.deliveries.Add(1)
+	go func() {
+		defer b.deliveries.Done()
+		defer func() { <-b.inFlight }()
+		b.deliverBatch(batch, retry)
+	}()
+	return true
+}
+
+// deliverBatch delivers a batch and records the outcome
+func (b *batcher[T]) deliverBatch(batch []T, retry bool) {
+	failed, err := b.deliver(batch, retry)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.RecordsSucceeded += uint64(len(batch) - failed)
+	b.stats.RecordsFailed += uint64(failed)
+	if failed == 0 {
+		b.stats.BatchesSucceeded++
+	} else {
+		b.stats.BatchesFailed++
+	}
+	if failed < len(batch) {
+		b.stats.LastDelivered = time.Now()
+		b.stats.ConsecutiveFailedBatches = 0
+	} else {
+		b.stats.ConsecutiveFailedBatches++
+	}
+	if err != nil {
+		b.stats.LastDeliveryError = err
+		b.stats.LastDeliveryErrorTime = time.Now()
+		b.errs = append(b.errs, fmt.Errorf("failed to deliver %d of %d records: %w", failed, len(batch), err))
+	}
+}
+
+// deliver sends a batch, retrying with exponential backoff on failure. If the
+// sender reports a partial failure, only the retryable records are sent again.
+// Returns the number of records that could not be delivered. Senders are
+// responsible for applying their own timeouts to each attempt
+func (b *batcher[T]) deliver(batch []T, retry bool) (int, error) {
+	backoff := b.opts.RetryBackoff
+	rejected := 0
+	var rejectErr error
+	for attempt := 0; ; attempt++ {
+		err := b.send(context.Background(), batch)
+		if err == nil {
+			return rejected, rejectErr
+		}
+
+		var partial *partialFailure[T]
+		if errors.As(err, &partial) {
+			rejected += partial.failed
+			if partial.failed > 0 {
+				rejectErr = err
+			}
+			batch = partial.retry
+			if len(batch) == 0 {
+				return rejected, rejectErr
+			}
+		}
+		if errors.Is(err, ErrPermanent) || !retry || attempt >= b.opts.MaxRetries {
+			if rejectErr != nil && rejectErr != err {
+				err = errors.Join(rejectErr, err)
+			}
+			return rejected + len(batch), err
+		}
+
+		select {
+		case <-b.stop:
+			// Shutting down; make one last attempt rather than waiting out the backoff
+			retry = false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
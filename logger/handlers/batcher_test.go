@@ -0,0 +1,79 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Shared fixtures for the tests of the batching outputs
+
+// testBatchConfig returns the batch config with flushes left to the batch size and
+// quick retries, so tests control when batches are sent
+func testBatchConfig(batch config.BatchConfig) config.BatchConfig {
+	batch.FlushInterval = time.Hour
+	batch.MaxRetries = 3
+	batch.RetryBackoff = time.Millisecond
+	return batch
+}
+
+// Formats records for the outputs that wrap a writing handler
+func newJSONTestHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, nil)
+}
+
+// Items received by a test server, safe to record and read concurrently
+type received[T any] struct {
+	mu    sync.Mutex
+	items []T
+}
+
+func (r *received[T]) add(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = append(r.items, item)
+}
+
+// all returns a copy of the items received so far
+func (r *received[T]) all() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]T{}, r.items...)
+}
+
+// Wait until the handler has finished delivering the expected number of records
+func waitForBatchStats(t *testing.T, handler slog.Handler, records uint64) handlers.BatchStats {
+	reporter := handler.(handlers.BatchStatsReporter)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stats := reporter.BatchStats()
+		if stats.RecordsSucceeded+stats.RecordsFailed >= records {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %v records to be delivered", records)
+	return handlers.BatchStats{}
+}
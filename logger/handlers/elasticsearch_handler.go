@@ -0,0 +1,271 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Handler that wraps another slog handler, writing its JSON output to Elasticsearch
+// in batches via the _bulk API
+type ElasticsearchHandler struct {
+	formatter recordFormatter
+	sink      *elasticsearchSink
+}
+
+// A single document queued for indexing
+type elasticsearchDoc struct {
+	index string
+	body  []byte
+}
+
+type elasticsearchSink struct {
+	opts    config.ElasticsearchOutputConfig
+	index   indexPattern
+	client  *elasticsearch.Client
+	batcher *batcher[elasticsearchDoc]
+}
+
+// Construct a new Elasticsearch bulk log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// then queues the resulting JSON document for indexing into the index specified by esOpts
+func NewElasticsearchHandler(esOpts config.ElasticsearchOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
+	if len(esOpts.Addresses) == 0 {
+		return nil, errors.New("elasticsearch output enabled but no addresses are set")
+	}
+	if esOpts.Index == "" {
+		return nil, errors.New("elasticsearch output enabled but index is empty")
+	}
+
+	// Retries are handled by the batcher, so that only the failed documents are resent
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:    esOpts.Addresses,
+		DisableRetry: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Elasticsearch client: %w", err)
+	}
+
+	sink := &elasticsearchSink{
+		opts:   esOpts,
+		index:  parseIndexPattern(esOpts.Index),
+		client: client,
+	}
+	sink.batcher = newBatcher(esOpts.Batch, sink.send)
+
+	return &ElasticsearchHandler{
+		formatter: newRecordFormatter(supplyHandler),
+		sink:      sink,
+	}, nil
+}
+
+func (e *ElasticsearchHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return e.formatter.enabled(ctx, level)
+}
+
+// Required by slog.Handler interface: Processes a log via the writing handler, then
+// queues the result for indexing. Returns any errors from previously failed deliveries
+func (e *ElasticsearchHandler) Handle(ctx context.Context, r slog.Record) error {
+	body, err := e.formatter.format(ctx, r)
+	if err != nil {
+		return err
+	}
+	if e.sink.opts.DataStream && len(body) > 1 && body[0] == '{' {
+		// Data streams require an @timestamp field on every document
+		timestamp, _ := json.Marshal(r.Time.UTC().Format(time.RFC3339Nano))
+		prefix := append([]byte(`{"@timestamp":`), timestamp...)
+		body = append(append(prefix, ','), body[1:]...)
+	}
+
+	return e.sink.batcher.add(elasticsearchDoc{index: e.sink.index.expand(r.Time), body: body})
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (e *ElasticsearchHandler) WithGroup(name string) slog.Handler {
+	return &ElasticsearchHandler{formatter: e.formatter.withGroup(name), sink: e.sink}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (e *ElasticsearchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ElasticsearchHandler{formatter: e.formatter.withAttrs(attrs), sink: e.sink}
+}
+
+// BatchStats reports the handler's delivery statistics
+func (e *ElasticsearchHandler) BatchStats() BatchStats {
+	return e.sink.batcher.batchStats()
+}
+
+// BytesWritten reports the number of bytes of formatted records the handler has accepted
+func (e *ElasticsearchHandler) BytesWritten() uint64 {
+	return e.formatter.bytesWritten()
+}
+
+// Close indexes any queued records
+func (e *ElasticsearchHandler) Close() error {
+	return e.sink.batcher.close()
+}
+
+// Subset of the _bulk API response needed to find per-document failures
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// send indexes a batch with a single _bulk request. Documents rejected with a
+// retryable status (429 or 5xx) are handed back to the batcher to send again
+func (s *elasticsearchSink) send(ctx context.Context, batch []elasticsearchDoc) error {
+	action := "index"
+	if s.opts.DataStream {
+		action = "create"
+	}
+	body := &bytes.Buffer{}
+	for _, doc := range batch {
+		meta, _ := json.Marshal(map[string]any{action: map[string]string{"_index": doc.index}})
+		body.Write(meta)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+
+	if s.opts.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.RequestTimeout)
+		defer cancel()
+	}
+	res, err := s.client.Bulk(body, s.client.Bulk.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to execute bulk request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return fmt.Errorf("bulk request failed: %s", res.String())
+	}
+	if res.IsError() {
+		return Permanent(fmt.Errorf("bulk request rejected: %s", res.String()))
+	}
+
+	var bulkResp bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
+		return fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !bulkResp.Errors {
+		return nil
+	}
+
+	partial := &partialFailure[elasticsearchDoc]{}
+	var firstErr string
+	for i, item := range bulkResp.Items {
+		for _, result := range item {
+			if result.Status < 300 || i >= len(batch) {
+				continue
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				partial.retry = append(partial.retry, batch[i])
+			} else {
+				partial.failed++
+			}
+			if firstErr == "" {
+				firstErr = fmt.Sprintf("%d %s: %s", result.Status, result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	partial.err = fmt.Errorf("%d of %d documents failed, first error: %s",
+		len(partial.retry)+partial.failed, len(batch), firstErr)
+	return partial
+}
+
+// Index name with optional date patterns, in the %{+yyyy.MM.dd} form used by
+// Logstash and Beats
+type indexPattern []indexSegment
+
+type indexSegment struct {
+	literal string
+	layout  string
+}
+
+// Joda-style date tokens supported in index patterns and their Go equivalents
+var jodaLayouts = map[string]string{
+	"yyyy": "2006", "YYYY": "2006", "yy": "06", "MM": "01", "dd": "02", "HH": "15",
+}
+
+func parseIndexPattern(pattern string) indexPattern {
+	var segments indexPattern
+	for {
+		start := strings.Index(pattern, "%{+")
+		end := strings.Index(pattern[max(start, 0):], "}")
+		if start < 0 || end < 0 {
+			segments = append(segments, indexSegment{literal: pattern})
+			return segments
+		}
+		end += start
+		segments = append(segments, indexSegment{literal: pattern[:start]})
+		segments = append(segments, indexSegment{layout: jodaToLayout(pattern[start+3 : end])})
+		pattern = pattern[end+1:]
+	}
+}
+
+// jodaToLayout converts a Joda date format into a Go time layout, passing through
+// any characters that aren't recognized date tokens
+func jodaToLayout(format string) string {
+	layout := strings.Builder{}
+	for len(format) > 0 {
+		run := 1
+		for run < len(format) && format[run] == format[0] {
+			run++
+		}
+		if goLayout, ok := jodaLayouts[format[:run]]; ok {
+			layout.WriteString(goLayout)
+		} else {
+			layout.WriteString(format[:run])
+		}
+		format = format[run:]
+	}
+	return layout.String()
+}
+
+// expand returns the index name for a record logged at the given time. Dates are
+// always computed in UTC, matching Elasticsearch's own date math
+func (p indexPattern) expand(t time.Time) string {
+	name := strings.Builder{}
+	for _, segment := range p {
+		name.WriteString(segment.literal)
+		if segment.layout != "" {
+			name.WriteString(t.UTC().Format(segment.layout))
+		}
+	}
+	return name.String()
+}
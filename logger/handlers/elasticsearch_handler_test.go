@@ -0,0 +1,193 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// A document received by the test bulk endpoint
+type bulkDoc struct {
+	action string
+	index  string
+	source map[string]any
+}
+
+// Stand-in for the Elasticsearch _bulk endpoint. Documents with a "reject"
+// attribute fail with a mapping error, and documents with a "throttle"
+// attribute are rejected with a 429 the first time they're seen
+type bulkServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	docs      received[bulkDoc]
+	throttled map[string]bool
+}
+
+func mkBulkServer(t *testing.T) *bulkServer {
+	srv := &bulkServer{throttled: map[string]bool{}}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/_bulk" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		items := []map[string]any{}
+		hasErrors := false
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			meta := map[string]map[string]string{}
+			if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil || !scanner.Scan() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			doc := bulkDoc{}
+			for action, params := range meta {
+				doc.action, doc.index = action, params["_index"]
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &doc.source); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			result := map[string]any{"_index": doc.index, "status": http.StatusCreated}
+			msg, _ := doc.source["msg"].(string)
+			if _, ok := doc.source["reject"]; ok {
+				hasErrors = true
+				result["status"] = http.StatusBadRequest
+				result["error"] = map[string]string{"type": "mapper_parsing_exception", "reason": "failed to parse"}
+			} else if _, ok := doc.source["throttle"]; ok && !srv.throttled[msg] {
+				hasErrors = true
+				srv.throttled[msg] = true
+				result["status"] = http.StatusTooManyRequests
+				result["error"] = map[string]string{"type": "es_rejected_execution_exception", "reason": "queue full"}
+			} else {
+				srv.docs.add(doc)
+			}
+			items = append(items, map[string]any{doc.action: result})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"took": 1, "errors": hasErrors, "items": items})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newElasticsearchTestHandler(t *testing.T, esCfg config.ElasticsearchOutputConfig) slog.Handler {
+	esCfg.Batch = testBatchConfig(esCfg.Batch)
+	handler, err := handlers.NewElasticsearchHandler(esCfg, newJSONTestHandler)
+	if err != nil {
+		t.Fatalf("Failed to construct Elasticsearch handler: %v", err)
+	}
+	return handler
+}
+
+// Ensure that records are indexed into a date-based index, that throttled
+// documents are retried, and that rejected documents are reported in LogStats
+func TestElasticsearchHandlerBulk(t *testing.T) {
+	srv := mkBulkServer(t)
+	esHandler := newElasticsearchTestHandler(t, config.ElasticsearchOutputConfig{
+		Addresses: []string{srv.URL},
+		Index:     "chtc-logs-%{+yyyy.MM.dd}",
+		Batch:     config.BatchConfig{MaxBatchSize: 3},
+	})
+	statsHandler := logger.NewLogStatsHandler(config.Config{}, []handlers.NamedHandler{{
+		Handler:     esHandler,
+		HandlerType: "elasticsearch_output",
+	}})
+	defer statsHandler.(io.Closer).Close()
+	log := slog.New(statsHandler)
+
+	var lastStats logger.LogStats
+	statsHandler.SetStatsCallbackHandler(func(stats logger.LogStats) {
+		lastStats = stats
+	})
+
+	log.Info(testMsg)
+	log.Warn(testMsg2, slog.Bool("throttle", true))
+	log.Error("rejected", slog.Bool("reject", true))
+
+	stats := waitForBatchStats(t, esHandler, 3)
+	if stats.RecordsSucceeded != 2 || stats.RecordsFailed != 1 || stats.BatchesFailed != 1 {
+		t.Fatalf("Expected 2 records delivered and 1 failed in 1 batch, got %+v", stats)
+	}
+
+	docs := srv.docs.all()
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 indexed documents, got %v", len(docs))
+	}
+	expectedIndex := "chtc-logs-" + time.Now().UTC().Format("2006.01.02")
+	for _, doc := range docs {
+		if doc.action != "index" || doc.index != expectedIndex {
+			t.Fatalf("Expected document indexed into %v, got %v into %v", expectedIndex, doc.action, doc.index)
+		}
+	}
+	if docs[1].source["msg"] != testMsg2 {
+		t.Fatalf("Expected throttled document to be retried, got %v", docs[1].source)
+	}
+
+	// The rejected document is reported along with the next record
+	log.Info(testMsg)
+	if batchStats := lastStats.Batches["elasticsearch_output"]; batchStats.RecordsFailed != 1 || batchStats.Queued != 1 {
+		t.Fatalf("Expected LogStats to report 1 failed and 1 queued record, got %+v", batchStats)
+	}
+	if len(lastStats.Errors) != 1 || lastStats.Errors[0].Handler.HandlerType != "elasticsearch_output" {
+		t.Fatalf("Expected 1 error from elasticsearch_output, got %v", lastStats.Errors)
+	}
+}
+
+// Ensure that data stream writes use the create action and include @timestamp
+func TestElasticsearchHandlerDataStream(t *testing.T) {
+	srv := mkBulkServer(t)
+	esHandler := newElasticsearchTestHandler(t, config.ElasticsearchOutputConfig{
+		Addresses:  []string{srv.URL},
+		Index:      "logs-chtc-default",
+		DataStream: true,
+		Batch:      config.BatchConfig{MaxBatchSize: 1},
+	})
+	log := slog.New(esHandler)
+
+	log.InfoContext(context.Background(), testMsg)
+	waitForBatchStats(t, esHandler, 1)
+
+	docs := srv.docs.all()
+	if len(docs) != 1 || docs[0].action != "create" || docs[0].index != "logs-chtc-default" {
+		t.Fatalf("Expected 1 document created in logs-chtc-default, got %+v", docs)
+	}
+	if _, ok := docs[0].source["@timestamp"]; !ok {
+		t.Fatalf("Expected data stream document to include @timestamp, got %v", docs[0].source)
+	}
+	if err := esHandler.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error closing handler: %v", err)
+	}
+}
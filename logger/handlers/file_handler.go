@@ -0,0 +1,69 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Handler that wraps another slog handler, writing its output to a rotating log file
+type FileHandler struct {
+	slog.Handler
+	file    *RotatingFile
+	written *CountingWriter
+}
+
+// Construct a new file log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// which writes to the log file described by fileOpts
+func NewFileHandler(fileOpts config.FileOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
+	file, err := NewRotatingFile(fileOpts)
+	if err != nil {
+		return nil, err
+	}
+	written := NewCountingWriter(file)
+	return &FileHandler{Handler: supplyHandler(written), file: file, written: written}, nil
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (f *FileHandler) WithGroup(name string) slog.Handler {
+	return &FileHandler{Handler: f.Handler.WithGroup(name), file: f.file, written: f.written}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (f *FileHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FileHandler{Handler: f.Handler.WithAttrs(attrs), file: f.file, written: f.written}
+}
+
+// Rotate rotates the log file immediately
+func (f *FileHandler) Rotate() error {
+	return f.file.Rotate()
+}
+
+// BytesWritten reports the number of bytes written to the log file
+func (f *FileHandler) BytesWritten() uint64 {
+	return f.written.BytesWritten()
+}
+
+// Close closes the log file
+func (f *FileHandler) Close() error {
+	return f.file.Close()
+}
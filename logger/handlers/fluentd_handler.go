@@ -0,0 +1,273 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Handler that wraps another slog handler, delivering its output to a fluentd or
+// fluent-bit forward input using the Forward protocol. Records are batched into
+// chunks and delivered from a background goroutine, optionally waiting for the
+// server to acknowledge each chunk
+type FluentdHandler struct {
+	formatter recordFormatter
+	sink      *fluentdSink
+}
+
+// A single event queued for delivery
+type fluentdEntry struct {
+	tag    string
+	time   time.Time
+	record map[string]any
+}
+
+// Connection state shared between a handler and its children. The connection is
+// only used from the batcher's delivery goroutine
+type fluentdSink struct {
+	opts      config.FluentdOutputConfig
+	tlsConfig *tls.Config
+	batcher   *batcher[fluentdEntry]
+	conn      net.Conn
+	dec       *msgpack.Decoder
+}
+
+// Forward protocol EventTime, msgpack extension type 0
+type eventTime time.Time
+
+func (t eventTime) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeExtHeader(0, 8); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Time(t).Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(time.Time(t).Nanosecond()))
+	_, err := enc.Writer().Write(b[:])
+	return err
+}
+
+// Construct a new fluentd forward log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// then queues the resulting record for delivery to the forward input specified by fluentdOpts
+func NewFluentdHandler(fluentdOpts config.FluentdOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
+	switch fluentdOpts.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported fluentd output network %q", fluentdOpts.Network)
+	}
+	if fluentdOpts.Addr == "" {
+		return nil, errors.New("fluentd output enabled but addr is empty")
+	}
+	if fluentdOpts.Tag == "" {
+		return nil, errors.New("fluentd output enabled but tag is empty")
+	}
+
+	tlsConfig, err := fluentdOpts.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && fluentdOpts.Network == "unix" {
+		return nil, errors.New("TLS is not supported over unix sockets")
+	}
+
+	sink := &fluentdSink{opts: fluentdOpts, tlsConfig: tlsConfig}
+	sink.batcher = newBatcher(fluentdOpts.Batch, sink.send)
+
+	return &FluentdHandler{
+		formatter: newRecordFormatter(supplyHandler),
+		sink:      sink,
+	}, nil
+}
+
+func (f *FluentdHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return f.formatter.enabled(ctx, level)
+}
+
+// Required by slog.Handler interface: Processes a log via the writing handler, then
+// queues the result for delivery. Returns any errors from previously failed deliveries
+func (f *FluentdHandler) Handle(ctx context.Context, r slog.Record) error {
+	payload, err := f.formatter.format(ctx, r)
+	if err != nil {
+		return err
+	}
+	record, err := decodeRecord(payload)
+	if err != nil {
+		return err
+	}
+	// The event time is sent separately, as fluentd's own parsers would do
+	delete(record, slog.TimeKey)
+
+	tag := f.sink.opts.Tag
+	if f.sink.opts.TagKey != "" {
+		if recordTag, ok := record[f.sink.opts.TagKey].(string); ok && recordTag != "" {
+			tag = recordTag
+		}
+	}
+
+	return f.sink.batcher.add(fluentdEntry{tag: tag, time: r.Time, record: record})
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (f *FluentdHandler) WithGroup(name string) slog.Handler {
+	return &FluentdHandler{formatter: f.formatter.withGroup(name), sink: f.sink}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (f *FluentdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FluentdHandler{formatter: f.formatter.withAttrs(attrs), sink: f.sink}
+}
+
+// BatchStats reports the handler's delivery statistics
+func (f *FluentdHandler) BatchStats() BatchStats {
+	return f.sink.batcher.batchStats()
+}
+
+// BytesWritten reports the number of bytes of formatted records the handler has accepted
+func (f *FluentdHandler) BytesWritten() uint64 {
+	return f.formatter.bytesWritten()
+}
+
+// Close delivers any queued records, then closes the connection to the forward input
+func (f *FluentdHandler) Close() error {
+	err := f.sink.batcher.close()
+	f.sink.disconnect()
+	return err
+}
+
+// send delivers a batch as one Forward mode message per tag. If a tag fails after
+// others were delivered, only the entries of the undelivered tags are retried
+func (s *fluentdSink) send(ctx context.Context, batch []fluentdEntry) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	tags := []string{}
+	byTag := map[string][]fluentdEntry{}
+	for _, entry := range batch {
+		if _, ok := byTag[entry.tag]; !ok {
+			tags = append(tags, entry.tag)
+		}
+		byTag[entry.tag] = append(byTag[entry.tag], entry)
+	}
+
+	for i, tag := range tags {
+		entries := make([]any, 0, len(byTag[tag]))
+		for _, entry := range byTag[tag] {
+			entries = append(entries, []any{eventTime(entry.time), entry.record})
+		}
+		if err := s.sendChunk(tag, entries); err != nil {
+			// Drop the connection, since the stream may now be out of sync
+			s.disconnect()
+			if i == 0 {
+				return err
+			}
+			undelivered := []fluentdEntry{}
+			for _, remaining := range tags[i:] {
+				undelivered = append(undelivered, byTag[remaining]...)
+			}
+			return &partialFailure[fluentdEntry]{retry: undelivered, err: err}
+		}
+	}
+	return nil
+}
+
+func (s *fluentdSink) sendChunk(tag string, entries []any) error {
+	options := map[string]any{"size": len(entries)}
+	var chunk string
+	if s.opts.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		options["chunk"] = chunk
+	}
+
+	data, err := msgpack.Marshal([]any{tag, entries, options})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	if s.opts.WriteTimeout > 0 {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.conn.Write(data); err != nil {
+		return err
+	}
+	if !s.opts.RequireAck {
+		return nil
+	}
+
+	if s.opts.AckTimeout > 0 {
+		if err := s.conn.SetReadDeadline(time.Now().Add(s.opts.AckTimeout)); err != nil {
+			return err
+		}
+	}
+	resp, err := s.dec.DecodeMap()
+	if err != nil {
+		return fmt.Errorf("failed to read fluentd ack: %w", err)
+	}
+	if ack, _ := resp["ack"].(string); ack != chunk {
+		return fmt.Errorf("fluentd acknowledged chunk %q, expected %q", ack, chunk)
+	}
+	return nil
+}
+
+func (s *fluentdSink) connect() error {
+	dialer := &net.Dialer{Timeout: s.opts.DialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, s.opts.Network, s.opts.Addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.opts.Network, s.opts.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.dec = msgpack.NewDecoder(conn)
+	return nil
+}
+
+func (s *fluentdSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.dec = nil
+	}
+}
@@ -0,0 +1,304 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// A single event received by the test forward server
+type forwardEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]any
+}
+
+// In-process stand-in for a fluentd forward input. Decodes Forward mode messages
+// and acknowledges each chunk, unless told to ignore the next few chunks after
+// acknowledging a number of them first
+type forwardServer struct {
+	listener  net.Listener
+	events    chan forwardEvent
+	chunks    atomic.Int32
+	ackFirst  atomic.Int32
+	ignoreAck atomic.Int32
+}
+
+func mkForwardServer(t *testing.T) *forwardServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	srv := &forwardServer{listener: listener, events: make(chan forwardEvent, 100)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (s *forwardServer) serve(conn net.Conn) {
+	defer conn.Close()
+	dec := msgpack.NewDecoder(conn)
+	for {
+		if _, err := dec.DecodeArrayLen(); err != nil {
+			return
+		}
+		tag, err := dec.DecodeString()
+		if err != nil {
+			return
+		}
+		entryCount, err := dec.DecodeArrayLen()
+		if err != nil {
+			return
+		}
+		events := make([]forwardEvent, 0, entryCount)
+		for i := 0; i < entryCount; i++ {
+			if _, err := dec.DecodeArrayLen(); err != nil {
+				return
+			}
+			// EventTime is msgpack ext type 0 holding big-endian seconds and nanoseconds
+			if extID, extLen, err := dec.DecodeExtHeader(); err != nil || extID != 0 || extLen != 8 {
+				return
+			}
+			raw := make([]byte, 8)
+			if err := dec.ReadFull(raw); err != nil {
+				return
+			}
+			record, err := dec.DecodeMap()
+			if err != nil {
+				return
+			}
+			events = append(events, forwardEvent{
+				tag:    tag,
+				time:   time.Unix(int64(binary.BigEndian.Uint32(raw[:4])), int64(binary.BigEndian.Uint32(raw[4:]))),
+				record: record,
+			})
+		}
+		options, err := dec.DecodeMap()
+		if err != nil {
+			return
+		}
+		s.chunks.Add(1)
+
+		if s.ackFirst.Add(-1) < 0 && s.ignoreAck.Add(-1) >= 0 {
+			// Simulate a lost chunk; the client must time out and resend
+			continue
+		}
+		for _, event := range events {
+			s.events <- event
+		}
+		if chunk, ok := options["chunk"]; ok {
+			resp, _ := msgpack.Marshal(map[string]any{"ack": chunk})
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *forwardServer) nextEvent(t *testing.T) forwardEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for forwarded event")
+	}
+	return forwardEvent{}
+}
+
+func newFluentdTestLogger(t *testing.T, fluentdCfg config.FluentdOutputConfig) *logger.ContextAwareLogger {
+	fluentdCfg.Enabled = true
+	fluentdCfg.Network = "tcp"
+	fluentdCfg.RequireAck = true
+	log, err := logger.NewContextAwareLogger(config.Config{FluentdOutput: fluentdCfg})
+	if err != nil {
+		t.Fatalf("Failed to construct fluentd handler: %v", err)
+	}
+	return log
+}
+
+// Ensure that records are batched into acknowledged chunks, with the configured
+// tag and with attributes preserved as msgpack values
+func TestFluentdHandlerForward(t *testing.T) {
+	srv := mkForwardServer(t)
+	log := newFluentdTestLogger(t, config.FluentdOutputConfig{
+		Addr:   srv.listener.Addr().String(),
+		Tag:    "chtc.test",
+		TagKey: "fluent_tag",
+		Batch: config.BatchConfig{
+			MaxBatchSize:  3,
+			FlushInterval: time.Hour,
+		},
+	})
+
+	before := time.Now()
+	log.Info(context.Background(), testMsg, slog.Int("count", 7))
+	log.Warn(context.Background(), testMsg2)
+	log.Error(context.Background(), testMsg, slog.String("fluent_tag", "chtc.other"))
+
+	event := srv.nextEvent(t)
+	if event.tag != "chtc.test" || event.record["msg"] != testMsg || event.record["level"] != "INFO" {
+		t.Fatalf("Unexpected first event %+v", event)
+	}
+	if count := reflect.ValueOf(event.record["count"]); !count.CanInt() || count.Int() != 7 {
+		t.Fatalf("Expected integer attribute to be preserved, got %#v", event.record["count"])
+	}
+	if event.time.Before(before.Truncate(time.Second)) {
+		t.Fatalf("Expected event time after %v, got %v", before, event.time)
+	}
+	if _, ok := event.record["time"]; ok {
+		t.Fatal("Expected the record time to be sent as the event time only")
+	}
+
+	event = srv.nextEvent(t)
+	if event.tag != "chtc.test" || event.record["msg"] != testMsg2 {
+		t.Fatalf("Unexpected second event %+v", event)
+	}
+	event = srv.nextEvent(t)
+	if event.tag != "chtc.other" || event.record["level"] != "ERROR" {
+		t.Fatalf("Expected third event to use its own tag, got %+v", event)
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unexpected error closing logger: %v", err)
+	}
+}
+
+// Ensure that a chunk which isn't acknowledged in time is sent again
+func TestFluentdHandlerAckRetry(t *testing.T) {
+	srv := mkForwardServer(t)
+	srv.ignoreAck.Store(1)
+	log := newFluentdTestLogger(t, config.FluentdOutputConfig{
+		Addr:       srv.listener.Addr().String(),
+		Tag:        "chtc.test",
+		AckTimeout: 100 * time.Millisecond,
+		Batch: config.BatchConfig{
+			MaxBatchSize:  1,
+			FlushInterval: time.Hour,
+			MaxRetries:    3,
+			RetryBackoff:  10 * time.Millisecond,
+		},
+	})
+
+	log.Info(context.Background(), testMsg)
+	if event := srv.nextEvent(t); event.record["msg"] != testMsg {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+	if chunks := srv.chunks.Load(); chunks != 2 {
+		t.Fatalf("Expected the chunk to be sent twice, got %v", chunks)
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unexpected error closing logger: %v", err)
+	}
+}
+
+// Ensure that when a batch holds several tags and one isn't acknowledged, only
+// that tag's chunk is sent again, so the acknowledged records aren't duplicated
+func TestFluentdHandlerPartialRetry(t *testing.T) {
+	srv := mkForwardServer(t)
+	srv.ackFirst.Store(1)
+	srv.ignoreAck.Store(1)
+	log := newFluentdTestLogger(t, config.FluentdOutputConfig{
+		Addr:       srv.listener.Addr().String(),
+		Tag:        "chtc.test",
+		TagKey:     "fluent_tag",
+		AckTimeout: 100 * time.Millisecond,
+		Batch: config.BatchConfig{
+			MaxBatchSize:  2,
+			FlushInterval: time.Hour,
+			MaxRetries:    3,
+			RetryBackoff:  10 * time.Millisecond,
+		},
+	})
+
+	log.Info(context.Background(), testMsg)
+	log.Info(context.Background(), testMsg2, slog.String("fluent_tag", "chtc.other"))
+	if event := srv.nextEvent(t); event.tag != "chtc.test" {
+		t.Fatalf("Expected the first tag to be delivered first, got %+v", event)
+	}
+	if event := srv.nextEvent(t); event.tag != "chtc.other" {
+		t.Fatalf("Expected the second tag to be delivered once retried, got %+v", event)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unexpected error closing logger: %v", err)
+	}
+	if chunks := srv.chunks.Load(); chunks != 3 || len(srv.events) != 0 {
+		t.Fatalf("Expected only the unacknowledged chunk to be resent, got %v chunks and %v extra events", chunks, len(srv.events))
+	}
+}
+
+// Ensure that chunks that can't be delivered are reported as errors
+// against the fluentd handler
+func TestFluentdHandlerDeliveryError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	log := newFluentdTestLogger(t, config.FluentdOutputConfig{
+		Addr: addr,
+		Tag:  "chtc.test",
+		Batch: config.BatchConfig{
+			MaxBatchSize:  1,
+			FlushInterval: time.Hour,
+			MaxRetries:    1,
+			RetryBackoff:  time.Millisecond,
+		},
+	})
+	defer log.Close()
+
+	var lastStats logger.LogStats
+	log.SetErrorCallback(func(stats logger.LogStats) {
+		lastStats = stats
+	})
+
+	// Delivery happens in the background, so the failure is reported with a later record
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		log.Info(context.Background(), testMsg)
+		for _, logErr := range lastStats.Errors {
+			if logErr.Handler.HandlerType == "fluentd_output" {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected a delivery error from fluentd_output, got %v", lastStats.Errors)
+}
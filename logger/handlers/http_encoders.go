@@ -0,0 +1,269 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// A single record queued for delivery by the HTTP handler
+type HTTPRecord struct {
+	// Time the record was logged
+	Time time.Time
+	// Level the record was logged at
+	Level slog.Level
+	// The record as formatted by the writing handler
+	Payload []byte
+	// Payload decoded into its top-level fields
+	Fields map[string]any
+}
+
+// Encodes a batch of records into the body of a single HTTP request
+type HTTPEncoder interface {
+	// Content-Type header to send with the encoded body
+	ContentType() string
+	Encode(batch []HTTPRecord) ([]byte, error)
+}
+
+// Function that constructs an encoder from the HTTP output config
+type HTTPEncoderFactory func(httpOpts config.HTTPOutputConfig) (HTTPEncoder, error)
+
+var (
+	httpEncodersMu sync.RWMutex
+	httpEncoders   = map[string]HTTPEncoderFactory{
+		"json":       newJSONArrayEncoder,
+		"loki":       newLokiEncoder,
+		"splunk_hec": newSplunkHECEncoder,
+	}
+)
+
+// RegisterHTTPEncoder makes an encoder available to the HTTP output under the given
+// name, replacing any existing encoder with that name
+func RegisterHTTPEncoder(name string, factory HTTPEncoderFactory) {
+	httpEncodersMu.Lock()
+	defer httpEncodersMu.Unlock()
+	httpEncoders[name] = factory
+}
+
+func lookupHTTPEncoder(name string) (HTTPEncoderFactory, bool) {
+	httpEncodersMu.RLock()
+	defer httpEncodersMu.RUnlock()
+	factory, ok := httpEncoders[name]
+	return factory, ok
+}
+
+// Encodes a batch as a JSON array of records
+type jsonArrayEncoder struct{}
+
+func newJSONArrayEncoder(config.HTTPOutputConfig) (HTTPEncoder, error) {
+	return jsonArrayEncoder{}, nil
+}
+
+func (jsonArrayEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (jsonArrayEncoder) Encode(batch []HTTPRecord) ([]byte, error) {
+	body := &bytes.Buffer{}
+	body.WriteByte('[')
+	for i, record := range batch {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(record.Payload)
+	}
+	body.WriteByte(']')
+	return body.Bytes(), nil
+}
+
+// Encodes a batch as a Grafana Loki push request, with one stream per distinct
+// set of labels. Each log line is the record's full JSON
+type lokiEncoder struct {
+	opts   config.LokiEncoderConfig
+	labels []lokiLabel
+}
+
+// A record attribute used as a stream label
+type lokiLabel struct {
+	// Dotted path of the attribute, through any groups
+	path string
+	// Label name, with characters Loki does not allow replaced
+	name string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLokiEncoder(httpOpts config.HTTPOutputConfig) (HTTPEncoder, error) {
+	if len(httpOpts.Loki.Labels) == 0 && len(httpOpts.Loki.StaticLabels) == 0 {
+		return nil, fmt.Errorf("loki encoder requires at least one label")
+	}
+	// Loki rejects the whole push request if any stream has an invalid label name
+	for name := range httpOpts.Loki.StaticLabels {
+		if name == "" || lokiLabelName(name) != name {
+			return nil, fmt.Errorf("loki static label %q is not a valid label name", name)
+		}
+	}
+	labels := make([]lokiLabel, 0, len(httpOpts.Loki.Labels))
+	for _, path := range httpOpts.Loki.Labels {
+		if path == "" {
+			return nil, fmt.Errorf("loki labels must not be empty")
+		}
+		labels = append(labels, lokiLabel{path: path, name: lokiLabelName(path)})
+	}
+	return lokiEncoder{opts: httpOpts.Loki, labels: labels}, nil
+}
+
+func (lokiEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (l lokiEncoder) Encode(batch []HTTPRecord) ([]byte, error) {
+	streams := []*lokiStream{}
+	byLabels := map[string]*lokiStream{}
+	for _, record := range batch {
+		labels := map[string]string{}
+		for key, value := range l.opts.StaticLabels {
+			labels[key] = value
+		}
+		for _, label := range l.labels {
+			if value, ok := lookupField(record.Fields, label.path); ok {
+				labels[label.name] = fmt.Sprint(value)
+			}
+		}
+		if len(labels) == 0 {
+			// Loki rejects streams without any labels
+			labels["level"] = record.Level.String()
+		}
+
+		id := lokiStreamID(labels)
+		stream, ok := byLabels[id]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			byLabels[id] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(record.Time.UnixNano(), 10), string(record.Payload)})
+	}
+	return json.Marshal(map[string]any{"streams": streams})
+}
+
+// lokiLabelName returns a label name matching [a-zA-Z_][a-zA-Z0-9_]* for an attribute
+// path, replacing the dots between groups and any other invalid characters with '_'
+func lokiLabelName(path string) string {
+	name := []byte(path)
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// lookupField returns the value at a dotted path in a decoded record, descending into
+// the objects of attribute groups. Keys that themselves contain dots are matched whole
+func lookupField(fields map[string]any, path string) (any, bool) {
+	if value, ok := fields[path]; ok {
+		return value, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if group, ok := fields[path[:i]].(map[string]any); ok {
+			if value, ok := lookupField(group, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// lokiStreamID returns a canonical string identifying a set of labels
+func lokiStreamID(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	id := strings.Builder{}
+	for _, key := range keys {
+		fmt.Fprintf(&id, "%q=%q,", key, labels[key])
+	}
+	return id.String()
+}
+
+// Encodes a batch for the Splunk HTTP Event Collector, as concatenated event objects
+type splunkHECEncoder struct {
+	opts config.SplunkHECConfig
+}
+
+type splunkEvent struct {
+	Time       float64        `json:"time"`
+	Host       string         `json:"host,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	SourceType string         `json:"sourcetype,omitempty"`
+	Index      string         `json:"index,omitempty"`
+	Event      map[string]any `json:"event"`
+}
+
+func newSplunkHECEncoder(httpOpts config.HTTPOutputConfig) (HTTPEncoder, error) {
+	opts := httpOpts.Splunk
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	return splunkHECEncoder{opts: opts}, nil
+}
+
+func (splunkHECEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (s splunkHECEncoder) Encode(batch []HTTPRecord) ([]byte, error) {
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, record := range batch {
+		err := enc.Encode(splunkEvent{
+			// HEC expects epoch seconds, with fractional milliseconds
+			Time:       float64(record.Time.UnixMilli()) / 1000,
+			Host:       s.opts.Host,
+			Source:     s.opts.Source,
+			SourceType: s.opts.SourceType,
+			Index:      s.opts.Index,
+			Event:      record.Fields,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
@@ -0,0 +1,204 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Handler that wraps another slog handler, POSTing batches of its JSON output to
+// an HTTP endpoint. The request body is produced by a pluggable HTTPEncoder
+type HTTPHandler struct {
+	formatter recordFormatter
+	sink      *httpSink
+}
+
+type httpSink struct {
+	opts    config.HTTPOutputConfig
+	client  *http.Client
+	encoder HTTPEncoder
+	batcher *batcher[HTTPRecord]
+}
+
+// Construct a new HTTP log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// then queues the result to be sent to the URL specified by httpOpts, encoded with the
+// encoder it names
+func NewHTTPHandler(httpOpts config.HTTPOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
+	if httpOpts.URL == "" {
+		return nil, errors.New("http output enabled but url is empty")
+	}
+	switch httpOpts.Compression {
+	case "", "none", "gzip":
+	default:
+		return nil, fmt.Errorf("unsupported http output compression %q", httpOpts.Compression)
+	}
+
+	factory, ok := lookupHTTPEncoder(httpOpts.Encoder)
+	if !ok {
+		return nil, fmt.Errorf("unknown http output encoder %q", httpOpts.Encoder)
+	}
+	encoder, err := factory(httpOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpOpts.TokenFile != "" {
+		// Fail early if the token can't be read, rather than on every request
+		if _, err := os.ReadFile(httpOpts.TokenFile); err != nil {
+			return nil, fmt.Errorf("failed to read http output token file: %w", err)
+		}
+	}
+
+	tlsConfig, err := httpOpts.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	sink := &httpSink{
+		opts:    httpOpts,
+		client:  &http.Client{Transport: transport, Timeout: httpOpts.RequestTimeout},
+		encoder: encoder,
+	}
+	sink.batcher = newConcurrentBatcher(httpOpts.Batch, httpOpts.MaxInFlight, sink.send)
+
+	return &HTTPHandler{
+		formatter: newRecordFormatter(supplyHandler),
+		sink:      sink,
+	}, nil
+}
+
+func (h *HTTPHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.formatter.enabled(ctx, level)
+}
+
+// Required by slog.Handler interface: Processes a log via the writing handler, then
+// queues the result for delivery. Returns any errors from previously failed deliveries
+func (h *HTTPHandler) Handle(ctx context.Context, r slog.Record) error {
+	payload, err := h.formatter.format(ctx, r)
+	if err != nil {
+		return err
+	}
+	fields, err := decodeRecord(payload)
+	if err != nil {
+		return err
+	}
+	return h.sink.batcher.add(HTTPRecord{Time: r.Time, Level: r.Level, Payload: payload, Fields: fields})
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (h *HTTPHandler) WithGroup(name string) slog.Handler {
+	return &HTTPHandler{formatter: h.formatter.withGroup(name), sink: h.sink}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (h *HTTPHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &HTTPHandler{formatter: h.formatter.withAttrs(attrs), sink: h.sink}
+}
+
+// BatchStats reports the handler's delivery statistics
+func (h *HTTPHandler) BatchStats() BatchStats {
+	return h.sink.batcher.batchStats()
+}
+
+// BytesWritten reports the number of bytes of formatted records the handler has accepted
+func (h *HTTPHandler) BytesWritten() uint64 {
+	return h.formatter.bytesWritten()
+}
+
+// Close sends any queued records
+func (h *HTTPHandler) Close() error {
+	err := h.sink.batcher.close()
+	h.sink.client.CloseIdleConnections()
+	return err
+}
+
+// send encodes a batch and POSTs it in a single request
+func (s *httpSink) send(ctx context.Context, batch []HTTPRecord) error {
+	payload, err := s.encoder.Encode(batch)
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to encode request: %w", err))
+	}
+
+	body := &bytes.Buffer{}
+	if s.opts.Compression == "gzip" {
+		gz := gzip.NewWriter(body)
+		if _, err := gz.Write(payload); err != nil {
+			return Permanent(err)
+		}
+		if err := gz.Close(); err != nil {
+			return Permanent(err)
+		}
+	} else {
+		body.Write(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.URL, body)
+	if err != nil {
+		return Permanent(err)
+	}
+	for key, value := range s.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", s.encoder.ContentType())
+	if s.opts.Compression == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.opts.TokenFile != "" {
+		// Re-read the token for each request, so that rotated tokens are picked up
+		token, err := os.ReadFile(s.opts.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %w", err)
+		}
+		scheme := s.opts.AuthScheme
+		if scheme == "" {
+			scheme = "Bearer"
+		}
+		req.Header.Set("Authorization", scheme+" "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send records: %w", err)
+	}
+	defer res.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	switch {
+	case res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return fmt.Errorf("request failed: %s: %s", res.Status, respBody)
+	default:
+		return Permanent(fmt.Errorf("request rejected: %s: %s", res.Status, respBody))
+	}
+}
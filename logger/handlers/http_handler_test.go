@@ -0,0 +1,287 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// A request received by the test HTTP sink, decompressed
+type httpRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// Stand-in for an HTTP log sink that records each request. If block is set, each
+// request waits on it before responding
+type httpSink struct {
+	*httptest.Server
+	requests received[httpRequest]
+	block    chan struct{}
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func mkHTTPSink(t *testing.T) *httpSink {
+	srv := &httpSink{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := srv.inFlight.Add(1)
+		defer srv.inFlight.Add(-1)
+		for seen := srv.maxSeen.Load(); current > seen && !srv.maxSeen.CompareAndSwap(seen, current); seen = srv.maxSeen.Load() {
+		}
+		if srv.block != nil {
+			<-srv.block
+		}
+
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		payload, err := io.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		srv.requests.add(httpRequest{header: r.Header.Clone(), body: payload})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newHTTPTestHandler(t *testing.T, httpCfg config.HTTPOutputConfig) slog.Handler {
+	httpCfg.Batch = testBatchConfig(httpCfg.Batch)
+	handler, err := handlers.NewHTTPHandler(httpCfg, newJSONTestHandler)
+	if err != nil {
+		t.Fatalf("Failed to construct HTTP handler: %v", err)
+	}
+	return handler
+}
+
+// Ensure that the Loki encoder groups records into streams by their labels, and
+// that the bearer token is read from its file and sent with each request
+func TestHTTPHandlerLoki(t *testing.T) {
+	srv := mkHTTPSink(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatalf("Unable to write token file: %v", err)
+	}
+	httpHandler := newHTTPTestHandler(t, config.HTTPOutputConfig{
+		URL:         srv.URL + "/loki/api/v1/push",
+		Encoder:     "loki",
+		TokenFile:   tokenFile,
+		Compression: "gzip",
+		Headers:     map[string]string{"X-Scope-OrgID": "chtc"},
+		Batch:       config.BatchConfig{MaxBatchSize: 3},
+		Loki: config.LokiEncoderConfig{
+			Labels:       []string{"level"},
+			StaticLabels: map[string]string{"job": "test"},
+		},
+	})
+	log := slog.New(httpHandler)
+
+	log.Info(testMsg)
+	log.Warn(testMsg2)
+	log.Info(testMsg2)
+	waitForBatchStats(t, httpHandler, 3)
+
+	requests := srv.requests.all()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 push request, got %v", len(requests))
+	}
+	if auth := requests[0].header.Get("Authorization"); auth != "Bearer secret-token" {
+		t.Fatalf("Expected bearer token from file, got %q", auth)
+	}
+	if requests[0].header.Get("X-Scope-OrgID") != "chtc" {
+		t.Fatalf("Expected configured header to be sent, got %v", requests[0].header)
+	}
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(requests[0].body, &push); err != nil {
+		t.Fatalf("Unable to decode push request: %v", err)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %+v", push.Streams)
+	}
+	info := push.Streams[0]
+	if info.Stream["level"] != "INFO" || info.Stream["job"] != "test" || len(info.Values) != 2 {
+		t.Fatalf("Expected 2 INFO entries labeled with job=test, got %+v", info)
+	}
+	line := map[string]any{}
+	if err := json.Unmarshal([]byte(info.Values[1][1]), &line); err != nil || line["msg"] != testMsg2 {
+		t.Fatalf("Expected log line to contain the record JSON, got %v", info.Values[1][1])
+	}
+	if push.Streams[1].Stream["level"] != "WARN" || len(push.Streams[1].Values) != 1 {
+		t.Fatalf("Expected 1 WARN entry, got %+v", push.Streams[1])
+	}
+}
+
+// Ensure that Loki labels can be taken from attributes in groups, with label names
+// Loki accepts, and that invalid static label names are rejected
+func TestHTTPHandlerLokiLabels(t *testing.T) {
+	srv := mkHTTPSink(t)
+	httpHandler := newHTTPTestHandler(t, config.HTTPOutputConfig{
+		URL:     srv.URL + "/loki/api/v1/push",
+		Encoder: "loki",
+		Batch:   config.BatchConfig{MaxBatchSize: 1},
+		Loki:    config.LokiEncoderConfig{Labels: []string{"request.method", "service-name"}},
+	})
+	slog.New(httpHandler).Info(testMsg, slog.Group("request", slog.String("method", "GET")), slog.String("service-name", "ap40"))
+	waitForBatchStats(t, httpHandler, 1)
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+		} `json:"streams"`
+	}
+	if requests := srv.requests.all(); len(requests) != 1 || json.Unmarshal(requests[0].body, &push) != nil || len(push.Streams) != 1 {
+		t.Fatalf("Expected 1 push request with 1 stream, got %+v", requests)
+	}
+	if labels := push.Streams[0].Stream; len(labels) != 2 || labels["request_method"] != "GET" || labels["service_name"] != "ap40" {
+		t.Fatalf("Expected sanitized labels from the group and attribute, got %v", labels)
+	}
+
+	_, err := handlers.NewHTTPHandler(config.HTTPOutputConfig{
+		URL:     srv.URL,
+		Encoder: "loki",
+		Loki:    config.LokiEncoderConfig{StaticLabels: map[string]string{"service.name": "ap40"}},
+	}, newJSONTestHandler)
+	if err == nil {
+		t.Fatalf("Expected an invalid static label name to be rejected")
+	}
+}
+
+// Ensure that the Splunk HEC encoder sends one event object per record
+func TestHTTPHandlerSplunkHEC(t *testing.T) {
+	srv := mkHTTPSink(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("hec-token"), 0600); err != nil {
+		t.Fatalf("Unable to write token file: %v", err)
+	}
+	httpHandler := newHTTPTestHandler(t, config.HTTPOutputConfig{
+		URL:        srv.URL + "/services/collector/event",
+		Encoder:    "splunk_hec",
+		TokenFile:  tokenFile,
+		AuthScheme: "Splunk",
+		Batch:      config.BatchConfig{MaxBatchSize: 2},
+		Splunk:     config.SplunkHECConfig{Index: "chtc", SourceType: "_json", Host: "ap40"},
+	})
+	log := slog.New(httpHandler)
+
+	log.Info(testMsg, slog.Int("job", 42))
+	log.Error(testMsg2)
+	waitForBatchStats(t, httpHandler, 2)
+
+	requests := srv.requests.all()
+	if len(requests) != 1 || requests[0].header.Get("Authorization") != "Splunk hec-token" {
+		t.Fatalf("Expected 1 request with Splunk authorization, got %+v", requests)
+	}
+	dec := json.NewDecoder(bytes.NewReader(requests[0].body))
+	for _, expected := range []string{testMsg, testMsg2} {
+		var event struct {
+			Time       float64        `json:"time"`
+			Host       string         `json:"host"`
+			Index      string         `json:"index"`
+			SourceType string         `json:"sourcetype"`
+			Event      map[string]any `json:"event"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatalf("Unable to decode HEC event: %v", err)
+		}
+		if event.Event["msg"] != expected || event.Host != "ap40" || event.Index != "chtc" || event.SourceType != "_json" {
+			t.Fatalf("Unexpected HEC event %+v", event)
+		}
+		if time.Since(time.UnixMilli(int64(event.Time*1000))) > time.Minute {
+			t.Fatalf("Expected event time in epoch seconds, got %v", event.Time)
+		}
+	}
+}
+
+// Encoder used to test registering custom encoders
+type countingEncoder struct{}
+
+func (countingEncoder) ContentType() string { return "text/plain" }
+
+func (countingEncoder) Encode(batch []handlers.HTTPRecord) ([]byte, error) {
+	return []byte(strconv.Itoa(len(batch))), nil
+}
+
+// Ensure that custom encoders can be registered, and that no more than the
+// configured number of requests are sent at once
+func TestHTTPHandlerMaxInFlight(t *testing.T) {
+	handlers.RegisterHTTPEncoder("counting", func(config.HTTPOutputConfig) (handlers.HTTPEncoder, error) {
+		return countingEncoder{}, nil
+	})
+	srv := mkHTTPSink(t)
+	srv.block = make(chan struct{})
+	httpHandler := newHTTPTestHandler(t, config.HTTPOutputConfig{
+		URL:         srv.URL,
+		Encoder:     "counting",
+		MaxInFlight: 2,
+		Batch:       config.BatchConfig{MaxBatchSize: 1},
+	})
+	log := slog.New(httpHandler)
+
+	for i := 0; i < 4; i++ {
+		log.Info(testMsg)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.inFlight.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give a third request the chance to be sent, if the limit isn't honored
+	time.Sleep(50 * time.Millisecond)
+	close(srv.block)
+	waitForBatchStats(t, httpHandler, 4)
+
+	if maxSeen := srv.maxSeen.Load(); maxSeen != 2 {
+		t.Fatalf("Expected 2 requests in flight at once, got %v", maxSeen)
+	}
+	requests := srv.requests.all()
+	if len(requests) != 4 || string(requests[0].body) != "1" || requests[0].header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("Expected 4 requests from the custom encoder, got %+v", requests)
+	}
+	if err := httpHandler.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error closing handler: %v", err)
+	}
+}
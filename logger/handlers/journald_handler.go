@@ -0,0 +1,268 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Default location of the journald native protocol socket
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// Journald truncates field names longer than this
+const maxJournaldFieldLen = 64
+
+// Handler that writes each log record directly to the systemd journal using
+// the native journal protocol. slog attributes become journal fields
+type JournaldHandler struct {
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+	opts       slog.HandlerOptions
+	// Fields pre-rendered by WithAttrs, and the group prefix for any further attributes
+	fields []journalField
+	prefix string
+}
+
+type journalField struct {
+	key   string
+	value string
+}
+
+// Construct a new journald log handler.
+// Upon logging a message, the record's message, level and attributes are sent to the
+// journal socket specified by journaldOpts as a single native protocol datagram
+func NewJournaldHandler(journaldOpts config.JournaldOutputConfig, handlerOpts *slog.HandlerOptions) (slog.Handler, error) {
+	socketPath := journaldOpts.SocketPath
+	if socketPath == "" {
+		socketPath = DefaultJournaldSocket
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, fmt.Errorf("journald socket unavailable: %w", err)
+	}
+
+	// Journald identifies the sender via the socket's credentials, so an unbound
+	// datagram socket is all that's required
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "", Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	identifier := journaldOpts.Identifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	handler := JournaldHandler{
+		conn:       conn,
+		addr:       &net.UnixAddr{Name: socketPath, Net: "unixgram"},
+		identifier: identifier,
+	}
+	if handlerOpts != nil {
+		handler.opts = *handlerOpts
+	}
+	return &handler, nil
+}
+
+func (j *JournaldHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if j.opts.Level != nil {
+		minLevel = j.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Required by slog.Handler interface: Converts a record into journal fields and
+// sends them to journald
+func (j *JournaldHandler) Handle(ctx context.Context, r slog.Record) error {
+	buf := &bytes.Buffer{}
+	writeJournalField(buf, "MESSAGE", r.Message)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(journalPriority(r.Level)))
+	writeJournalField(buf, "SYSLOG_IDENTIFIER", j.identifier)
+
+	if j.opts.AddSource && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		frame, _ := frames.Next()
+		writeJournalField(buf, "CODE_FILE", frame.File)
+		writeJournalField(buf, "CODE_LINE", strconv.Itoa(frame.Line))
+		writeJournalField(buf, "CODE_FUNC", frame.Function)
+	}
+
+	for _, field := range j.fields {
+		writeJournalField(buf, field.key, field.value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flattenJournalAttr(j.prefix, a, func(key, value string) {
+			writeJournalField(buf, key, value)
+		})
+		return true
+	})
+
+	return j.send(buf.Bytes())
+}
+
+// send writes a single entry to the journal. Entries too large for a single
+// datagram are written to an unlinked temporary file whose descriptor is
+// passed to journald instead, as described in the native protocol docs
+func (j *JournaldHandler) send(data []byte) error {
+	_, _, err := j.conn.WriteMsgUnix(data, nil, j.addr)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	f, err := os.CreateTemp("/dev/shm", "chtc-journal.*")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	rights := syscall.UnixRights(int(f.Fd()))
+	_, _, err = j.conn.WriteMsgUnix([]byte{}, rights, j.addr)
+	return err
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace, which
+// becomes a prefix on the resulting journal field names
+func (j *JournaldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return j
+	}
+	child := *j
+	child.prefix = j.prefix + name + "_"
+	return &child
+}
+
+// Required by slog.Handler interface: Adds attributes that are included in every entry
+func (j *JournaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *j
+	child.fields = append([]journalField{}, j.fields...)
+	for _, a := range attrs {
+		flattenJournalAttr(j.prefix, a, func(key, value string) {
+			child.fields = append(child.fields, journalField{key: key, value: value})
+		})
+	}
+	return &child
+}
+
+// Close releases the handler's socket
+func (j *JournaldHandler) Close() error {
+	return j.conn.Close()
+}
+
+// journalPriority maps an slog level onto a syslog(3) priority
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// flattenJournalAttr walks an attribute, including nested groups, and calls emit
+// with a sanitized journal field name for each leaf value
+func flattenJournalAttr(prefix string, a slog.Attr, emit func(key, value string)) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "_"
+		}
+		for _, child := range a.Value.Group() {
+			flattenJournalAttr(groupPrefix, child, emit)
+		}
+		return
+	}
+
+	var value string
+	if a.Value.Kind() == slog.KindTime {
+		value = a.Value.Time().Format(time.RFC3339Nano)
+	} else {
+		value = a.Value.String()
+	}
+	emit(sanitizeJournalField(prefix+a.Key), value)
+}
+
+// sanitizeJournalField converts an attribute key into a valid journal field name.
+// Field names may only contain uppercase letters, digits and underscores, and may
+// not begin with an underscore (reserved for trusted fields) or a digit
+func sanitizeJournalField(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	field := strings.TrimLeft(string(name), "_")
+	if field == "" || (field[0] >= '0' && field[0] <= '9') {
+		field = "X_" + field
+	}
+	if len(field) > maxJournaldFieldLen {
+		field = field[:maxJournaldFieldLen]
+	}
+	return field
+}
+
+// writeJournalField serializes a single field. Values containing newlines must
+// be written with an explicit little-endian 64-bit length instead of '='
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,144 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger"
+)
+
+// Create a local datagram socket that stands in for journald
+func mkJournalSocket(t *testing.T) (*net.UnixConn, string) {
+	socketPath := path.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unable to create test journal socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, socketPath
+}
+
+// Read a single datagram from the test journal socket and decode its fields
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	buf := make([]byte, 64*1024)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Unable to set read deadline: %v", err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Unable to read journal entry: %v", err)
+	}
+
+	fields := map[string]string{}
+	data := buf[:n]
+	for len(data) > 0 {
+		lineEnd := bytes.IndexByte(data, '\n')
+		if lineEnd < 0 {
+			t.Fatalf("Malformed journal entry: %q", data)
+		}
+		line := data[:lineEnd]
+		data = data[lineEnd+1:]
+		if key, value, found := bytes.Cut(line, []byte("=")); found {
+			fields[string(key)] = string(value)
+			continue
+		}
+		// Binary-safe field: 64-bit little endian length followed by the value
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[string(line)] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func verifyJournalField(t *testing.T, fields map[string]string, key, expected string) {
+	if actual, ok := fields[key]; !ok || actual != expected {
+		t.Fatalf("Expected journal field %v=%q, got %q (entry %v)", key, expected, actual, fields)
+	}
+}
+
+// Ensure that messages are sent to journald with the expected fields
+func TestJournaldHandler(t *testing.T) {
+	conn, socketPath := mkJournalSocket(t)
+
+	config := config.Config{
+		JournaldOutput: config.JournaldOutputConfig{
+			Enabled:    true,
+			SocketPath: socketPath,
+			Identifier: "chtc-test",
+			AddSource:  true,
+		},
+	}
+
+	logger, err := logger.NewLogger(config)
+	if err != nil {
+		t.Fatalf("Failed to construct journald handler: %v", err)
+	}
+
+	// Test that levels map to priorities and attributes become fields
+	logger.Info(testMsg, slog.String("user-id", "12345"))
+	fields := readJournalEntry(t, conn)
+	verifyJournalField(t, fields, "MESSAGE", testMsg)
+	verifyJournalField(t, fields, "PRIORITY", "6")
+	verifyJournalField(t, fields, "SYSLOG_IDENTIFIER", "chtc-test")
+	verifyJournalField(t, fields, "USER_ID", "12345")
+	if !strings.HasSuffix(fields["CODE_FILE"], "journald_handler_test.go") {
+		t.Fatalf("Expected CODE_FILE to reference the test file, got %q", fields["CODE_FILE"])
+	}
+	if fields["CODE_LINE"] == "" {
+		t.Fatal("Expected CODE_LINE to be set")
+	}
+	// The sequence info group added by the logger itself is flattened too
+	verifyJournalField(t, fields, "SEQUENCE_INFO_SEQUENCE_NO", "1")
+
+	logger.Warn(testMsg2)
+	fields = readJournalEntry(t, conn)
+	verifyJournalField(t, fields, "MESSAGE", testMsg2)
+	verifyJournalField(t, fields, "PRIORITY", "4")
+
+	// Test that child loggers and groups are flattened into field names
+	childLogger := logger.With(slog.String("child", "key")).WithGroup("job")
+	childLogger.Error("multi\nline", slog.Int("id", 42))
+	fields = readJournalEntry(t, conn)
+	verifyJournalField(t, fields, "MESSAGE", "multi\nline")
+	verifyJournalField(t, fields, "PRIORITY", "3")
+	verifyJournalField(t, fields, "CHILD", "key")
+	verifyJournalField(t, fields, "JOB_ID", "42")
+}
+
+// Ensure that a missing journal socket is reported when constructing the logger
+func TestJournaldMissingSocket(t *testing.T) {
+	config := config.Config{
+		JournaldOutput: config.JournaldOutputConfig{
+			Enabled:    true,
+			SocketPath: path.Join(t.TempDir(), "missing.sock"),
+		},
+	}
+
+	if _, err := logger.NewLogger(config); err == nil {
+		t.Fatal("Expected an error constructing a logger with a missing journal socket")
+	}
+}
@@ -0,0 +1,542 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const (
+	// Protocol versions used for each request. These are the newest versions that
+	// predate flexible encoding, and are supported by Kafka 2.1 and later
+	kafkaMetadataVersion = 7
+	kafkaProduceVersion  = 7
+
+	// Record batch compression codecs, stored in the batch attributes
+	kafkaCodecNone   = 0
+	kafkaCodecGzip   = 1
+	kafkaCodecSnappy = 2
+	kafkaCodecZstd   = 4
+)
+
+// Names of Kafka error codes a producer may see. Those marked retriable are
+// transient, and usually resolved by refreshing metadata and trying again
+var kafkaErrors = map[int16]struct {
+	name      string
+	retriable bool
+}{
+	2:  {"CORRUPT_MESSAGE", false},
+	3:  {"UNKNOWN_TOPIC_OR_PARTITION", true},
+	5:  {"LEADER_NOT_AVAILABLE", true},
+	6:  {"NOT_LEADER_OR_FOLLOWER", true},
+	7:  {"REQUEST_TIMED_OUT", true},
+	10: {"MESSAGE_TOO_LARGE", false},
+	13: {"NETWORK_EXCEPTION", true},
+	17: {"INVALID_TOPIC_EXCEPTION", false},
+	18: {"RECORD_LIST_TOO_LARGE", false},
+	19: {"NOT_ENOUGH_REPLICAS", true},
+	20: {"NOT_ENOUGH_REPLICAS_AFTER_APPEND", true},
+	29: {"TOPIC_AUTHORIZATION_FAILED", false},
+	56: {"KAFKA_STORAGE_ERROR", true},
+	76: {"UNSUPPORTED_COMPRESSION_TYPE", false},
+	87: {"INVALID_RECORD", false},
+}
+
+// Error reported by a Kafka broker
+type kafkaError int16
+
+func (k kafkaError) Error() string {
+	if known, ok := kafkaErrors[int16(k)]; ok {
+		return fmt.Sprintf("kafka error %d (%s)", int16(k), known.name)
+	}
+	return fmt.Sprintf("kafka error %d", int16(k))
+}
+
+func (k kafkaError) retriable() bool {
+	return kafkaErrors[int16(k)].retriable
+}
+
+// QueueSink that produces messages to a Kafka topic using the Kafka wire protocol.
+// Messages with a key are assigned a partition by hashing the key, the same way
+// the Java client's default partitioner does; messages without one are spread
+// across partitions a batch at a time
+type KafkaSink struct {
+	opts      config.KafkaConfig
+	acks      int16
+	codec     int8
+	tlsConfig *tls.Config
+	formatter *kmsg.RequestFormatter
+	zstdEnc   *zstd.Encoder
+
+	mu sync.Mutex
+	// Address of each broker, by node ID
+	brokers map[int32]string
+	// Leader node ID of each partition of the topic, or -1 if it has none
+	leaders []int32
+	// Set when the partition leaders may have moved
+	stale         bool
+	conns         map[string]*kafkaConn
+	nextPartition int
+}
+
+type kafkaConn struct {
+	net.Conn
+	correlationID int32
+}
+
+// Construct a new Kafka sink. Brokers are not contacted until the first publish
+func NewKafkaSink(kafkaOpts config.KafkaConfig) (*KafkaSink, error) {
+	if len(kafkaOpts.Brokers) == 0 {
+		return nil, errors.New("kafka queue output enabled but no brokers are set")
+	}
+	if kafkaOpts.Topic == "" {
+		return nil, errors.New("kafka queue output enabled but topic is empty")
+	}
+
+	sink := &KafkaSink{
+		opts:    kafkaOpts,
+		brokers: map[int32]string{},
+		conns:   map[string]*kafkaConn{},
+	}
+	switch kafkaOpts.RequiredAcks {
+	case "none":
+		sink.acks = 0
+	case "leader":
+		sink.acks = 1
+	case "", "all":
+		sink.acks = -1
+	default:
+		return nil, fmt.Errorf("unsupported kafka required_acks %q", kafkaOpts.RequiredAcks)
+	}
+	switch kafkaOpts.Compression {
+	case "", "none":
+		sink.codec = kafkaCodecNone
+	case "gzip":
+		sink.codec = kafkaCodecGzip
+	case "snappy":
+		sink.codec = kafkaCodecSnappy
+	case "zstd":
+		sink.codec = kafkaCodecZstd
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		sink.zstdEnc = enc
+	default:
+		return nil, fmt.Errorf("unsupported kafka compression %q", kafkaOpts.Compression)
+	}
+
+	tlsConfig, err := kafkaOpts.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	sink.tlsConfig = tlsConfig
+
+	clientID := kafkaOpts.ClientID
+	if clientID == "" {
+		clientID = "chtc-go-logger"
+	}
+	sink.formatter = kmsg.NewRequestFormatter(kmsg.FormatterClientID(clientID))
+	return sink, nil
+}
+
+// Publish produces a batch of messages to the topic, sending one request to the
+// leader of each partition involved
+func (k *KafkaSink) Publish(ctx context.Context, messages []QueueMessage) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.leaders == nil || k.stale {
+		if err := k.refreshMetadata(ctx); err != nil {
+			return err
+		}
+	}
+
+	unkeyed := int32(k.nextPartition % len(k.leaders))
+	k.nextPartition++
+	byPartition := map[int32][]QueueMessage{}
+	for _, message := range messages {
+		partition := unkeyed
+		if message.Key != nil {
+			partition = kafkaPartition(message.Key, len(k.leaders))
+		}
+		byPartition[partition] = append(byPartition[partition], message)
+	}
+
+	publishErr := &PublishError{}
+	var errs []error
+	byLeader := map[int32]map[int32][]QueueMessage{}
+	for partition, partitionMessages := range byPartition {
+		leader := k.leaders[partition]
+		if _, ok := k.brokers[leader]; !ok {
+			k.stale = true
+			publishErr.Retry = append(publishErr.Retry, partitionMessages...)
+			errs = append(errs, fmt.Errorf("partition %d has no leader", partition))
+			continue
+		}
+		if byLeader[leader] == nil {
+			byLeader[leader] = map[int32][]QueueMessage{}
+		}
+		byLeader[leader][partition] = partitionMessages
+	}
+	for leader, partitions := range byLeader {
+		if err := k.produce(ctx, k.brokers[leader], partitions, publishErr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	publishErr.Err = errors.Join(errs...)
+	return publishErr
+}
+
+// Close closes all broker connections
+func (k *KafkaSink) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for addr := range k.conns {
+		k.disconnect(addr)
+	}
+	if k.zstdEnc != nil {
+		return k.zstdEnc.Close()
+	}
+	return nil
+}
+
+// produce sends the messages for one leader's partitions in a single request,
+// recording any that failed in publishErr
+func (k *KafkaSink) produce(ctx context.Context, addr string, partitions map[int32][]QueueMessage, publishErr *PublishError) error {
+	req := kmsg.NewPtrProduceRequest()
+	req.SetVersion(kafkaProduceVersion)
+	req.Acks = k.acks
+	req.TimeoutMillis = int32(k.opts.RequestTimeout.Milliseconds())
+	if req.TimeoutMillis <= 0 {
+		req.TimeoutMillis = 30000
+	}
+	topic := kmsg.NewProduceRequestTopic()
+	topic.Topic = k.opts.Topic
+
+	ids := make([]int32, 0, len(partitions))
+	for partition := range partitions {
+		ids = append(ids, partition)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, partition := range ids {
+		records, err := k.recordBatch(partitions[partition])
+		if err != nil {
+			for _, messages := range partitions {
+				publishErr.Failed += len(messages)
+			}
+			return fmt.Errorf("failed to encode record batch: %w", err)
+		}
+		topic.Partitions = append(topic.Partitions, kmsg.ProduceRequestTopicPartition{Partition: partition, Records: records})
+	}
+	req.Topics = append(req.Topics, topic)
+
+	resp, err := k.request(ctx, addr, req)
+	if err != nil {
+		// The broker may be gone, so find out who leads these partitions now
+		k.stale = true
+		for _, messages := range partitions {
+			publishErr.Retry = append(publishErr.Retry, messages...)
+		}
+		return err
+	}
+	if resp == nil {
+		// No acknowledgment was requested
+		return nil
+	}
+
+	var errs []error
+	for _, topicResp := range resp.(*kmsg.ProduceResponse).Topics {
+		for _, partitionResp := range topicResp.Partitions {
+			if partitionResp.ErrorCode == 0 {
+				continue
+			}
+			messages := partitions[partitionResp.Partition]
+			kafkaErr := kafkaError(partitionResp.ErrorCode)
+			if kafkaErr.retriable() {
+				k.stale = true
+				publishErr.Retry = append(publishErr.Retry, messages...)
+			} else {
+				publishErr.Failed += len(messages)
+			}
+			errs = append(errs, fmt.Errorf("failed to produce to partition %d: %w", partitionResp.Partition, kafkaErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshMetadata looks up the topic's partitions and their leaders, asking each
+// known broker in turn
+func (k *KafkaSink) refreshMetadata(ctx context.Context) error {
+	req := kmsg.NewPtrMetadataRequest()
+	req.SetVersion(kafkaMetadataVersion)
+	topic := kmsg.NewMetadataRequestTopic()
+	topic.Topic = kmsg.StringPtr(k.opts.Topic)
+	req.Topics = append(req.Topics, topic)
+	req.AllowAutoTopicCreation = true
+
+	addrs := append([]string{}, k.opts.Brokers...)
+	for _, addr := range k.brokers {
+		addrs = append(addrs, addr)
+	}
+	var errs []error
+	for _, addr := range addrs {
+		resp, err := k.request(ctx, addr, req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		metadata := resp.(*kmsg.MetadataResponse)
+
+		brokers := map[int32]string{}
+		for _, broker := range metadata.Brokers {
+			brokers[broker.NodeID] = net.JoinHostPort(broker.Host, strconv.Itoa(int(broker.Port)))
+		}
+		for _, topicMeta := range metadata.Topics {
+			if topicMeta.Topic == nil || *topicMeta.Topic != k.opts.Topic {
+				continue
+			}
+			if topicMeta.ErrorCode != 0 {
+				return fmt.Errorf("failed to look up topic %s: %w", k.opts.Topic, kafkaError(topicMeta.ErrorCode))
+			}
+			if len(topicMeta.Partitions) == 0 {
+				return fmt.Errorf("topic %s has no partitions", k.opts.Topic)
+			}
+			leaders := make([]int32, len(topicMeta.Partitions))
+			for i := range leaders {
+				leaders[i] = -1
+			}
+			for _, partition := range topicMeta.Partitions {
+				if partition.Partition >= 0 && int(partition.Partition) < len(leaders) && partition.ErrorCode == 0 {
+					leaders[partition.Partition] = partition.Leader
+				}
+			}
+			k.brokers, k.leaders, k.stale = brokers, leaders, false
+			return nil
+		}
+		return fmt.Errorf("broker %s returned no metadata for topic %s", addr, k.opts.Topic)
+	}
+	return fmt.Errorf("failed to fetch kafka metadata: %w", errors.Join(errs...))
+}
+
+// request sends a request to the broker at addr and reads its response. Returns
+// a nil response for produce requests that don't wait for acknowledgment
+func (k *KafkaSink) request(ctx context.Context, addr string, req kmsg.Request) (kmsg.Response, error) {
+	conn, err := k.connect(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.roundTrip(ctx, conn, req)
+	if err != nil {
+		// The stream may be out of sync, so start again with a new connection
+		k.disconnect(addr)
+		return nil, fmt.Errorf("kafka request to %s failed: %w", addr, err)
+	}
+	return resp, nil
+}
+
+func (k *KafkaSink) roundTrip(ctx context.Context, conn *kafkaConn, req kmsg.Request) (kmsg.Response, error) {
+	deadline := time.Time{}
+	if k.opts.RequestTimeout > 0 {
+		deadline = time.Now().Add(k.opts.RequestTimeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	conn.correlationID++
+	if _, err := conn.Write(k.formatter.AppendRequest(nil, req, conn.correlationID)); err != nil {
+		return nil, err
+	}
+	if produce, ok := req.(*kmsg.ProduceRequest); ok && produce.Acks == 0 {
+		return nil, nil
+	}
+
+	var size int32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	if correlationID := int32(binary.BigEndian.Uint32(body)); correlationID != conn.correlationID {
+		return nil, fmt.Errorf("response correlation ID %d does not match request %d", correlationID, conn.correlationID)
+	}
+	resp := req.ResponseKind()
+	if err := resp.ReadFrom(body[4:]); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp, nil
+}
+
+func (k *KafkaSink) connect(ctx context.Context, addr string) (*kafkaConn, error) {
+	if conn, ok := k.conns[addr]; ok {
+		return conn, nil
+	}
+	dialer := &net.Dialer{Timeout: k.opts.DialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if k.tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: k.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.conns[addr] = &kafkaConn{Conn: conn}
+	return k.conns[addr], nil
+}
+
+func (k *KafkaSink) disconnect(addr string) {
+	if conn, ok := k.conns[addr]; ok {
+		conn.Close()
+		delete(k.conns, addr)
+	}
+}
+
+// recordBatch encodes messages as a v2 record batch, compressing the records
+// with the configured codec
+func (k *KafkaSink) recordBatch(messages []QueueMessage) ([]byte, error) {
+	firstTimestamp := messages[0].Time.UnixMilli()
+	maxTimestamp := firstTimestamp
+	records := []byte{}
+	for i, message := range messages {
+		timestamp := message.Time.UnixMilli()
+		maxTimestamp = max(maxTimestamp, timestamp)
+		record := kmsg.Record{
+			TimestampDelta64: timestamp - firstTimestamp,
+			OffsetDelta:      int32(i),
+			Key:              message.Key,
+			Value:            message.Value,
+		}
+		// Each record is prefixed by the varint length of the rest of the record,
+		// so encode it with an empty length and replace that afterwards
+		encoded := record.AppendTo(nil)[1:]
+		records = binary.AppendVarint(records, int64(len(encoded)))
+		records = append(records, encoded...)
+	}
+
+	switch k.codec {
+	case kafkaCodecGzip:
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		if _, err := gz.Write(records); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		records = buf.Bytes()
+	case kafkaCodecSnappy:
+		records = s2.EncodeSnappy(nil, records)
+	case kafkaCodecZstd:
+		records = k.zstdEnc.EncodeAll(records, nil)
+	}
+
+	batch := kmsg.RecordBatch{
+		Magic:           2,
+		Attributes:      int16(k.codec),
+		LastOffsetDelta: int32(len(messages) - 1),
+		FirstTimestamp:  firstTimestamp,
+		MaxTimestamp:    maxTimestamp,
+		ProducerID:      -1,
+		ProducerEpoch:   -1,
+		FirstSequence:   -1,
+		NumRecords:      int32(len(messages)),
+		Records:         records,
+	}
+	encoded := batch.AppendTo(nil)
+	// Length counts everything after the length field, and the CRC covers
+	// everything after the CRC field
+	binary.BigEndian.PutUint32(encoded[8:12], uint32(len(encoded)-12))
+	binary.BigEndian.PutUint32(encoded[17:21], crc32.Checksum(encoded[21:], crc32.MakeTable(crc32.Castagnoli)))
+	return encoded, nil
+}
+
+// kafkaPartition chooses a partition for a key using murmur2, matching the Java
+// client so that keyed records land in the same partition as other producers'
+func kafkaPartition(key []byte, partitions int) int32 {
+	return (murmur2(key) & 0x7fffffff) % int32(partitions)
+}
+
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,313 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// In-process stand-in for a single Kafka broker leading every partition of
+// one topic. Produced records are decoded and kept per partition. Records whose
+// value contains "reject" are refused with INVALID_RECORD, and the next produce
+// to a partition listed in notLeader is refused with NOT_LEADER_OR_FOLLOWER
+type fakeKafkaBroker struct {
+	listener   net.Listener
+	topic      string
+	partitions int32
+
+	mu               sync.Mutex
+	records          map[int32][]kmsg.Record
+	codecs           map[int16]bool
+	metadataRequests int
+	notLeader        map[int32]bool
+}
+
+func mkFakeKafkaBroker(t *testing.T, topic string, partitions int32) *fakeKafkaBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	broker := &fakeKafkaBroker{
+		listener:   listener,
+		topic:      topic,
+		partitions: partitions,
+		records:    map[int32][]kmsg.Record{},
+		codecs:     map[int16]bool{},
+		notLeader:  map[int32]bool{},
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(t, conn)
+		}
+	}()
+	return broker
+}
+
+func (b *fakeKafkaBroker) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		// Request header: API key, version, correlation ID and client ID
+		key := int16(binary.BigEndian.Uint16(body[0:]))
+		version := int16(binary.BigEndian.Uint16(body[2:]))
+		correlationID := body[4:8]
+		clientIDLen := int16(binary.BigEndian.Uint16(body[8:]))
+		req := kmsg.RequestForKey(key)
+		req.SetVersion(version)
+		if err := req.ReadFrom(body[10+max(clientIDLen, 0):]); err != nil {
+			t.Errorf("Fake broker failed to decode request: %v", err)
+			return
+		}
+
+		var resp kmsg.Response
+		switch req := req.(type) {
+		case *kmsg.MetadataRequest:
+			resp = b.metadata()
+		case *kmsg.ProduceRequest:
+			resp = b.produce(t, req)
+			if req.Acks == 0 {
+				continue
+			}
+		default:
+			t.Errorf("Fake broker received unexpected request key %d", key)
+			return
+		}
+		resp.SetVersion(version)
+		out := resp.AppendTo(append([]byte{0, 0, 0, 0}, correlationID...))
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeKafkaBroker) metadata() kmsg.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metadataRequests++
+
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	resp := kmsg.NewPtrMetadataResponse()
+	resp.Brokers = []kmsg.MetadataResponseBroker{{NodeID: 1, Host: host, Port: int32(portNum)}}
+	topic := kmsg.NewMetadataResponseTopic()
+	topic.Topic = kmsg.StringPtr(b.topic)
+	for i := int32(0); i < b.partitions; i++ {
+		partition := kmsg.NewMetadataResponseTopicPartition()
+		partition.Partition, partition.Leader = i, 1
+		topic.Partitions = append(topic.Partitions, partition)
+	}
+	resp.Topics = append(resp.Topics, topic)
+	return resp
+}
+
+func (b *fakeKafkaBroker) produce(t *testing.T, req *kmsg.ProduceRequest) kmsg.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	resp := kmsg.NewPtrProduceResponse()
+	for _, topic := range req.Topics {
+		topicResp := kmsg.NewProduceResponseTopic()
+		topicResp.Topic = topic.Topic
+		for _, partition := range topic.Partitions {
+			partitionResp := kmsg.NewProduceResponseTopicPartition()
+			partitionResp.Partition = partition.Partition
+			records, codec := decodeRecordBatch(t, partition.Records)
+			b.codecs[codec] = true
+
+			if b.notLeader[partition.Partition] {
+				b.notLeader[partition.Partition] = false
+				partitionResp.ErrorCode = 6
+			} else {
+				for _, record := range records {
+					if strings.Contains(string(record.Value), "reject") {
+						partitionResp.ErrorCode = 87
+					}
+				}
+			}
+			if partitionResp.ErrorCode == 0 {
+				b.records[partition.Partition] = append(b.records[partition.Partition], records...)
+			}
+			topicResp.Partitions = append(topicResp.Partitions, partitionResp)
+		}
+		resp.Topics = append(resp.Topics, topicResp)
+	}
+	return resp
+}
+
+// decodeRecordBatch checks the batch's length and CRC, then decompresses and
+// decodes its records
+func decodeRecordBatch(t *testing.T, raw []byte) ([]kmsg.Record, int16) {
+	batch := kmsg.RecordBatch{}
+	if err := batch.ReadFrom(raw); err != nil {
+		t.Errorf("Unable to decode record batch: %v", err)
+		return nil, 0
+	}
+	if int(batch.Length) != len(raw)-12 || batch.Magic != 2 {
+		t.Errorf("Record batch has length %d and magic %d, expected %d and 2", batch.Length, batch.Magic, len(raw)-12)
+	}
+	if crc := crc32.Checksum(raw[21:], crc32.MakeTable(crc32.Castagnoli)); uint32(batch.CRC) != crc {
+		t.Errorf("Record batch CRC %x does not match %x", uint32(batch.CRC), crc)
+	}
+
+	data := batch.Records
+	codec := batch.Attributes & 0x7
+	if codec == 1 {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("Unable to decompress record batch: %v", err)
+			return nil, codec
+		}
+		data, _ = io.ReadAll(gz)
+	}
+
+	records := []kmsg.Record{}
+	for i := int32(0); i < batch.NumRecords; i++ {
+		length, n := binary.Varint(data)
+		record := kmsg.Record{}
+		if err := record.ReadFrom(data[:n+int(length)]); err != nil {
+			t.Errorf("Unable to decode record: %v", err)
+			return nil, codec
+		}
+		records = append(records, record)
+		data = data[n+int(length):]
+	}
+	return records, codec
+}
+
+func (b *fakeKafkaBroker) partitionRecords(partition int32) []kmsg.Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kmsg.Record{}, b.records[partition]...)
+}
+
+func newKafkaTestHandler(t *testing.T, broker *fakeKafkaBroker, batchSize int) slog.Handler {
+	sink, err := handlers.NewKafkaSink(config.KafkaConfig{
+		Brokers:        []string{broker.listener.Addr().String()},
+		Topic:          broker.topic,
+		RequiredAcks:   "all",
+		Compression:    "gzip",
+		RequestTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to construct Kafka sink: %v", err)
+	}
+	return newQueueTestHandler(t, config.QueueOutputConfig{
+		KeyAttribute: "key",
+		Batch:        config.BatchConfig{MaxBatchSize: batchSize},
+	}, sink)
+}
+
+// Ensure that records are produced in compressed batches, with keyed records
+// assigned the same partitions the Java client would choose, and that
+// partitions whose leader has moved are retried after refreshing metadata
+func TestKafkaSinkProduce(t *testing.T) {
+	broker := mkFakeKafkaBroker(t, "chtc-logs", 2)
+	broker.notLeader[1] = true
+	kafkaHandler := newKafkaTestHandler(t, broker, 3)
+	defer kafkaHandler.(io.Closer).Close()
+	log := slog.New(kafkaHandler)
+
+	// murmur2("foobar") is -790332482 and murmur2("abc") is 479470107
+	log.Info(testMsg, slog.String("key", "foobar"))
+	log.Info(testMsg2, slog.String("key", "abc"))
+	log.Warn(testMsg, slog.String("key", "foobar"))
+	stats := waitForBatchStats(t, kafkaHandler, 3)
+	if stats.RecordsSucceeded != 3 {
+		t.Fatalf("Expected 3 records produced, got %+v", stats)
+	}
+
+	partition0, partition1 := broker.partitionRecords(0), broker.partitionRecords(1)
+	if len(partition0) != 2 || len(partition1) != 1 {
+		t.Fatalf("Expected 2 records in partition 0 and 1 in partition 1, got %v and %v", len(partition0), len(partition1))
+	}
+	if string(partition0[0].Key) != "foobar" || string(partition1[0].Key) != "abc" {
+		t.Fatalf("Unexpected keys %q and %q", partition0[0].Key, partition1[0].Key)
+	}
+	if partition0[1].OffsetDelta != 1 || !strings.Contains(string(partition0[1].Value), `"level":"WARN"`) {
+		t.Fatalf("Unexpected second record in partition 0: %+v", partition0[1])
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if !broker.codecs[1] || len(broker.codecs) != 1 {
+		t.Fatalf("Expected every batch to be gzip compressed, got codecs %v", broker.codecs)
+	}
+	if broker.metadataRequests != 2 {
+		t.Fatalf("Expected metadata to be refreshed after NOT_LEADER_OR_FOLLOWER, got %v requests", broker.metadataRequests)
+	}
+}
+
+// Ensure that records the broker rejects are reported as errors against the
+// queue handler in LogStats
+func TestKafkaSinkRejected(t *testing.T) {
+	broker := mkFakeKafkaBroker(t, "chtc-logs", 1)
+	kafkaHandler := newKafkaTestHandler(t, broker, 1)
+	statsHandler := logger.NewLogStatsHandler(config.Config{}, []handlers.NamedHandler{{
+		Handler:     kafkaHandler,
+		HandlerType: "queue_output",
+	}})
+	defer statsHandler.(io.Closer).Close()
+	log := slog.New(statsHandler)
+
+	var lastStats logger.LogStats
+	statsHandler.SetStatsCallbackHandler(func(stats logger.LogStats) {
+		lastStats = stats
+	})
+
+	log.Error("reject this record")
+	if stats := waitForBatchStats(t, kafkaHandler, 1); stats.RecordsFailed != 1 {
+		t.Fatalf("Expected 1 rejected record, got %+v", stats)
+	}
+
+	log.Info(testMsg)
+	if len(lastStats.Errors) != 1 || lastStats.Errors[0].Handler.HandlerType != "queue_output" {
+		t.Fatalf("Expected 1 error from queue_output, got %v", lastStats.Errors)
+	}
+	if !strings.Contains(lastStats.Errors[0].Err.Error(), "INVALID_RECORD") {
+		t.Fatalf("Expected the broker's error to be reported, got %v", lastStats.Errors[0].Err)
+	}
+}
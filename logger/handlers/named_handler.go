@@ -18,7 +18,11 @@
 
 package handlers
 
-import "log/slog"
+import (
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
 
 // Wraper struct for a slog.Handler and a string label describing the handler
 // Used to determine which output stream an error occured in
@@ -26,3 +30,30 @@ type NamedHandler struct {
 	slog.Handler
 	HandlerType string
 }
+
+// Interface for handlers that can report how many bytes of formatted records they have written
+type BytesWrittenReporter interface {
+	BytesWritten() uint64
+}
+
+// CountingWriter wraps a writer, counting the bytes written through it
+type CountingWriter struct {
+	w       io.Writer
+	written *atomic.Uint64
+}
+
+// NewCountingWriter constructs a CountingWriter that writes to w
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w, written: &atomic.Uint64{}}
+}
+
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+// BytesWritten reports the number of bytes written so far
+func (c *CountingWriter) BytesWritten() uint64 {
+	return c.written.Load()
+}
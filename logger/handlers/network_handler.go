@@ -0,0 +1,206 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Supported ways of delimiting records on the wire
+const (
+	// Each record is followed by a newline
+	FramingNewline = "newline"
+	// Each record is preceded by its length in ASCII and a space, as in RFC 6587
+	FramingOctetCounted = "octet_counted"
+	// Each record is preceded by its length as a 4-byte big-endian integer
+	FramingLengthPrefixed = "length_prefixed"
+)
+
+// Handler that wraps another slog handler, streaming its output to a remote
+// collector over a TCP, UDP or Unix socket
+type NetworkHandler struct {
+	formatter recordFormatter
+	conn      *networkConn
+}
+
+// Connection state shared between a handler and its children
+type networkConn struct {
+	mu        sync.Mutex
+	opts      config.NetworkOutputConfig
+	tlsConfig *tls.Config
+	conn      net.Conn
+	lastDial  time.Time
+	lastErr   error
+	closed    bool
+}
+
+// Construct a new network-forwarding log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// then frames the output and writes it to the collector specified by networkOpts.
+// The connection is established lazily and re-established after any write failure
+func NewNetworkHandler(networkOpts config.NetworkOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
+	switch networkOpts.Network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unsupported network output network %q", networkOpts.Network)
+	}
+	switch networkOpts.Framing {
+	case FramingNewline, FramingOctetCounted, FramingLengthPrefixed:
+	default:
+		return nil, fmt.Errorf("unsupported network output framing %q", networkOpts.Framing)
+	}
+	if networkOpts.Addr == "" {
+		return nil, errors.New("network output enabled but addr is empty")
+	}
+
+	tlsConfig, err := networkOpts.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && !strings.HasPrefix(networkOpts.Network, "tcp") {
+		return nil, fmt.Errorf("TLS is not supported over network %q", networkOpts.Network)
+	}
+
+	return &NetworkHandler{
+		formatter: newRecordFormatter(supplyHandler),
+		conn:      &networkConn{opts: networkOpts, tlsConfig: tlsConfig},
+	}, nil
+}
+
+func (n *NetworkHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return n.formatter.enabled(ctx, level)
+}
+
+// Required by slog.Handler interface: Processes a log via the writing handler, then
+// forwards the framed output to the remote collector
+func (n *NetworkHandler) Handle(ctx context.Context, r slog.Record) error {
+	payload, err := n.formatter.format(ctx, r)
+	if err != nil {
+		return err
+	}
+	return n.conn.write(frameRecord(n.conn.opts.Framing, payload))
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (n *NetworkHandler) WithGroup(name string) slog.Handler {
+	return &NetworkHandler{formatter: n.formatter.withGroup(name), conn: n.conn}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (n *NetworkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &NetworkHandler{formatter: n.formatter.withAttrs(attrs), conn: n.conn}
+}
+
+// BytesWritten reports the number of bytes of formatted records the handler has accepted
+func (n *NetworkHandler) BytesWritten() uint64 {
+	return n.formatter.bytesWritten()
+}
+
+// Close closes the connection to the collector. Further records will fail to log
+func (n *NetworkHandler) Close() error {
+	n.conn.mu.Lock()
+	defer n.conn.mu.Unlock()
+	n.conn.closed = true
+	if n.conn.conn == nil {
+		return nil
+	}
+	err := n.conn.conn.Close()
+	n.conn.conn = nil
+	return err
+}
+
+// write sends a single framed record, dialing the collector first if required.
+// On failure the connection is dropped so that the next write reconnects
+func (c *networkConn) write(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.WriteTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout)); err != nil {
+			return err
+		}
+	}
+	if _, err := c.conn.Write(data); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *networkConn) dial() error {
+	// Avoid hammering an unavailable collector with a connection attempt per record
+	if since := time.Since(c.lastDial); c.lastErr != nil && since < c.opts.ReconnectDelay {
+		return fmt.Errorf("waiting %v to reconnect to %s: %w", c.opts.ReconnectDelay-since, c.opts.Addr, c.lastErr)
+	}
+	c.lastDial = time.Now()
+
+	dialer := &net.Dialer{Timeout: c.opts.DialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, c.opts.Network, c.opts.Addr, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(c.opts.Network, c.opts.Addr)
+	}
+	c.lastErr = err
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// frameRecord delimits a single record according to the configured framing
+func frameRecord(framing string, payload []byte) []byte {
+	switch framing {
+	case FramingOctetCounted:
+		framed := strconv.AppendInt(make([]byte, 0, len(payload)+12), int64(len(payload)), 10)
+		framed = append(framed, ' ')
+		return append(framed, payload...)
+	case FramingLengthPrefixed:
+		framed := binary.BigEndian.AppendUint32(make([]byte, 0, len(payload)+4), uint32(len(payload)))
+		return append(framed, payload...)
+	default:
+		return append(payload, '\n')
+	}
+}
@@ -0,0 +1,292 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Accept a single connection on the listener and return a reader over it
+func acceptTestConn(t *testing.T, listener net.Listener) *bufio.Reader {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept network output connection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Unable to set read deadline: %v", err)
+	}
+	return bufio.NewReader(conn)
+}
+
+// Decode a JSON log record and check that it contains the expected message
+func verifyNetworkRecord(t *testing.T, payload []byte, expectedMsg string) {
+	record := map[string]any{}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		t.Fatalf("Unable to decode network record %q: %v", payload, err)
+	}
+	if record["msg"] != expectedMsg {
+		t.Fatalf("Expected network record with message %q, got %q", expectedMsg, record["msg"])
+	}
+}
+
+func newNetworkTestLogger(t *testing.T, networkCfg config.NetworkOutputConfig) *logger.ContextAwareLogger {
+	networkCfg.Enabled = true
+	log, err := logger.NewContextAwareLogger(config.Config{NetworkOutput: networkCfg})
+	if err != nil {
+		t.Fatalf("Failed to construct network handler: %v", err)
+	}
+	return log
+}
+
+// Ensure that newline-framed records are streamed over TCP
+func TestNetworkHandlerTCPNewline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	log := newNetworkTestLogger(t, config.NetworkOutputConfig{
+		Network: "tcp",
+		Addr:    listener.Addr().String(),
+		Framing: handlers.FramingNewline,
+	})
+
+	log.Info(context.Background(), testMsg)
+	log.Warn(context.Background(), testMsg2)
+
+	reader := acceptTestConn(t, listener)
+	for _, expected := range []string{testMsg, testMsg2} {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("Unable to read record: %v", err)
+		}
+		verifyNetworkRecord(t, line, expected)
+	}
+}
+
+// Ensure that octet-counted records are streamed over a unix stream socket
+func TestNetworkHandlerUnixOctetCounted(t *testing.T) {
+	socketPath := path.Join(t.TempDir(), "collector.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	log := newNetworkTestLogger(t, config.NetworkOutputConfig{
+		Network: "unix",
+		Addr:    socketPath,
+		Framing: handlers.FramingOctetCounted,
+	})
+
+	log.Info(context.Background(), "multi\nline")
+
+	reader := acceptTestConn(t, listener)
+	sizeStr, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatalf("Unable to read record length: %v", err)
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(sizeStr, " "))
+	if err != nil {
+		t.Fatalf("Invalid record length %q: %v", sizeStr, err)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Unable to read record: %v", err)
+	}
+	verifyNetworkRecord(t, payload, "multi\nline")
+}
+
+// Ensure that length-prefixed records are sent as UDP datagrams
+func TestNetworkHandlerUDPLengthPrefixed(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	log := newNetworkTestLogger(t, config.NetworkOutputConfig{
+		Network: "udp",
+		Addr:    conn.LocalAddr().String(),
+		Framing: handlers.FramingLengthPrefixed,
+	})
+
+	log.Info(context.Background(), testMsg)
+
+	buf := make([]byte, 64*1024)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Unable to set read deadline: %v", err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unable to read datagram: %v", err)
+	}
+	size := binary.BigEndian.Uint32(buf[:4])
+	if int(size) != n-4 {
+		t.Fatalf("Expected length prefix %v to match datagram payload size %v", size, n-4)
+	}
+	verifyNetworkRecord(t, buf[4:n], testMsg)
+}
+
+// Create a self-signed certificate for localhost, writing it to a PEM file
+// that can be used as the client's CA file
+func mkTestCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+
+	caPath := path.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Unable to write CA file: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caPath
+}
+
+// Ensure that records can be streamed over TLS, verified against a private CA
+func TestNetworkHandlerTLS(t *testing.T) {
+	cert, caPath := mkTestCertificate(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	log := newNetworkTestLogger(t, config.NetworkOutputConfig{
+		Network: "tcp",
+		Addr:    listener.Addr().String(),
+		Framing: handlers.FramingNewline,
+		TLS: config.TLSConfig{
+			Enabled: true,
+			CAFile:  caPath,
+		},
+	})
+
+	// The TLS handshake completes once the server side accepts
+	done := make(chan []byte)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(done)
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadBytes('\n')
+		done <- line
+	}()
+
+	log.Info(context.Background(), testMsg)
+
+	select {
+	case line := <-done:
+		verifyNetworkRecord(t, line, testMsg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for TLS record")
+	}
+}
+
+// Ensure that failures to reach the collector are reported against the
+// network handler, and that the handler reconnects once the collector returns
+func TestNetworkHandlerReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	log := newNetworkTestLogger(t, config.NetworkOutputConfig{
+		Network:        "tcp",
+		Addr:           addr,
+		Framing:        handlers.FramingNewline,
+		ReconnectDelay: time.Nanosecond,
+	})
+
+	var lastStats logger.LogStats
+	log.SetErrorCallback(func(stats logger.LogStats) {
+		lastStats = stats
+	})
+
+	// The collector is down, so the record can't be delivered
+	log.Info(context.Background(), testMsg)
+	found := false
+	for _, logErr := range lastStats.Errors {
+		if logErr.Handler.HandlerType == "network_output" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected an error from network_output, got %v", lastStats.Errors)
+	}
+
+	// Bring the collector back up; the next record should be delivered
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to relisten: %v", err)
+	}
+	defer listener.Close()
+
+	log.Info(context.Background(), testMsg2)
+	reader := acceptTestConn(t, listener)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Unable to read record: %v", err)
+	}
+	verifyNetworkRecord(t, line, testMsg2)
+}
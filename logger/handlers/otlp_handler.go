@@ -0,0 +1,369 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	OTLPProtocolProtobuf = "http/protobuf"
+	OTLPProtocolJSON     = "http/json"
+
+	// Instrumentation scope reported for every exported record
+	otlpScopeName = "github.com/chtc/chtc-go-logger"
+)
+
+// Handler that converts slog records into OpenTelemetry LogRecords and exports
+// them in batches to an OTLP/HTTP logs endpoint, such as an OpenTelemetry collector
+type OTLPHandler struct {
+	opts *slog.HandlerOptions
+	// Attributes added via WithAttrs, for the top level and each open group
+	groups []otlpGroupAttrs
+	sink   *otlpSink
+}
+
+type otlpGroupAttrs struct {
+	name  string
+	attrs []*commonpb.KeyValue
+}
+
+type otlpSink struct {
+	opts     config.OTLPOutputConfig
+	client   *http.Client
+	resource *resourcepb.Resource
+	batcher  *batcher[*logspb.LogRecord]
+}
+
+// Construct a new OTLP log handler.
+// Upon logging a message, converts the record to an OTLP LogRecord and queues it for
+// export to the endpoint specified by otlpOpts. Records are reported as coming from the
+// service described by serviceOpts
+func NewOTLPHandler(otlpOpts config.OTLPOutputConfig, serviceOpts config.ServiceConfig, opts *slog.HandlerOptions) (slog.Handler, error) {
+	if otlpOpts.Endpoint == "" {
+		return nil, errors.New("otlp output enabled but endpoint is empty")
+	}
+	switch otlpOpts.Protocol {
+	case OTLPProtocolProtobuf, OTLPProtocolJSON:
+	default:
+		return nil, fmt.Errorf("unsupported otlp output protocol %q", otlpOpts.Protocol)
+	}
+	switch otlpOpts.Compression {
+	case "", "none", "gzip":
+	default:
+		return nil, fmt.Errorf("unsupported otlp output compression %q", otlpOpts.Compression)
+	}
+
+	tlsConfig, err := otlpOpts.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	sink := &otlpSink{
+		opts:     otlpOpts,
+		client:   &http.Client{Transport: transport, Timeout: otlpOpts.RequestTimeout},
+		resource: otlpResource(serviceOpts),
+	}
+	sink.batcher = newBatcher(otlpOpts.Batch, sink.send)
+
+	return &OTLPHandler{opts: opts, groups: []otlpGroupAttrs{{}}, sink: sink}, nil
+}
+
+// otlpResource describes the logging service using the OpenTelemetry semantic
+// conventions, defaulting the service name to the executable's name
+func otlpResource(serviceOpts config.ServiceConfig) *resourcepb.Resource {
+	attrs := map[string]string{}
+	for key, value := range serviceOpts.ResourceAttributes {
+		attrs[key] = value
+	}
+	attrs["service.name"] = serviceOpts.Name
+	if serviceOpts.Name == "" {
+		attrs["service.name"] = filepath.Base(os.Args[0])
+	}
+	if serviceOpts.Version != "" {
+		attrs["service.version"] = serviceOpts.Version
+	}
+	if serviceOpts.Environment != "" {
+		attrs["deployment.environment"] = serviceOpts.Environment
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{}
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attrs[key]}},
+		})
+	}
+	return resource
+}
+
+func (o *OTLPHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if o.opts.Level != nil {
+		minLevel = o.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Required by slog.Handler interface: Converts the record into an OTLP LogRecord and
+// queues it for export. Returns any errors from previously failed exports
+func (o *OTLPHandler) Handle(_ context.Context, r slog.Record) error {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(r.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       otlpSeverity(r.Level),
+		SeverityText:         r.Level.String(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: r.Message}},
+	}
+	if r.Time.IsZero() {
+		record.TimeUnixNano = 0
+	}
+
+	// Record attributes belong in the innermost group, which is then nested in each
+	// enclosing group. Groups left empty are omitted
+	attrs := append([]*commonpb.KeyValue{}, o.groups[len(o.groups)-1].attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = appendOTLPAttr(attrs, attr)
+		return true
+	})
+	for i := len(o.groups) - 1; i > 0; i-- {
+		enclosing := append([]*commonpb.KeyValue{}, o.groups[i-1].attrs...)
+		if len(attrs) > 0 {
+			enclosing = append(enclosing, otlpGroup(o.groups[i].name, attrs))
+		}
+		attrs = enclosing
+	}
+	record.Attributes = attrs
+
+	if o.opts.AddSource && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		frame, _ := frames.Next()
+		record.Attributes = append(record.Attributes,
+			otlpString("code.filepath", frame.File),
+			&commonpb.KeyValue{Key: "code.lineno", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(frame.Line)}}},
+			otlpString("code.function", frame.Function),
+		)
+	}
+
+	return o.sink.batcher.add(record)
+}
+
+// Required by slog.Handler interface: Nests any further attributes in a key/value list
+func (o *OTLPHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return o
+	}
+	child := *o
+	child.groups = append(append([]otlpGroupAttrs{}, o.groups...), otlpGroupAttrs{name: name})
+	return &child
+}
+
+// Required by slog.Handler interface: Adds attributes to every record, within the current group
+func (o *OTLPHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	converted := []*commonpb.KeyValue{}
+	for _, attr := range attrs {
+		converted = appendOTLPAttr(converted, attr)
+	}
+	if len(converted) == 0 {
+		return o
+	}
+	child := *o
+	child.groups = append([]otlpGroupAttrs{}, o.groups...)
+	innermost := &child.groups[len(child.groups)-1]
+	innermost.attrs = append(append([]*commonpb.KeyValue{}, innermost.attrs...), converted...)
+	return &child
+}
+
+// BatchStats reports the handler's delivery statistics
+func (o *OTLPHandler) BatchStats() BatchStats {
+	return o.sink.batcher.batchStats()
+}
+
+// Close exports any queued records
+func (o *OTLPHandler) Close() error {
+	err := o.sink.batcher.close()
+	o.sink.client.CloseIdleConnections()
+	return err
+}
+
+// otlpSeverity maps a slog level onto the OTLP severity number range, where
+// DEBUG, INFO, WARN and ERROR correspond to 5, 9, 13 and 17
+func otlpSeverity(level slog.Level) logspb.SeverityNumber {
+	severity := int(level) + int(logspb.SeverityNumber_SEVERITY_NUMBER_INFO)
+	severity = min(max(severity, int(logspb.SeverityNumber_SEVERITY_NUMBER_TRACE)), int(logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4))
+	return logspb.SeverityNumber(severity)
+}
+
+// appendOTLPAttr converts a slog attribute, appending it to attrs. Empty
+// attributes are dropped and inline groups are flattened, as slog handlers do
+func appendOTLPAttr(attrs []*commonpb.KeyValue, attr slog.Attr) []*commonpb.KeyValue {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		children := []*commonpb.KeyValue{}
+		for _, child := range attr.Value.Group() {
+			children = appendOTLPAttr(children, child)
+		}
+		if len(children) == 0 {
+			return attrs
+		}
+		if attr.Key == "" {
+			return append(attrs, children...)
+		}
+		return append(attrs, otlpGroup(attr.Key, children))
+	}
+	return append(attrs, &commonpb.KeyValue{Key: attr.Key, Value: otlpValue(attr.Value)})
+}
+
+func otlpValue(value slog.Value) *commonpb.AnyValue {
+	switch value.Kind() {
+	case slog.KindString:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value.String()}}
+	case slog.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value.Int64()}}
+	case slog.KindUint64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(value.Uint64())}}
+	case slog.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value.Float64()}}
+	case slog.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value.Bool()}}
+	case slog.KindTime:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value.Time().Format(time.RFC3339Nano)}}
+	}
+	if b, ok := value.Any().([]byte); ok {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: b}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value.String()}}
+}
+
+func otlpGroup(name string, attrs []*commonpb.KeyValue) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   name,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: attrs}}},
+	}
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// send exports a batch with a single request. The LogsData message shares its
+// encoding with the collector's ExportLogsServiceRequest, so it's sent as-is
+func (s *otlpSink) send(ctx context.Context, batch []*logspb.LogRecord) error {
+	logsData := &logspb.LogsData{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: s.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlpScopeName},
+				LogRecords: batch,
+			}},
+		}},
+	}
+
+	var (
+		payload     []byte
+		contentType string
+		err         error
+	)
+	if s.opts.Protocol == OTLPProtocolJSON {
+		// OTLP/JSON requires enum values to be sent as integers
+		payload, err = protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(logsData)
+		contentType = "application/json"
+	} else {
+		payload, err = proto.Marshal(logsData)
+		contentType = "application/x-protobuf"
+	}
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to encode OTLP request: %w", err))
+	}
+
+	body := &bytes.Buffer{}
+	if s.opts.Compression == "gzip" {
+		gz := gzip.NewWriter(body)
+		if _, err := gz.Write(payload); err != nil {
+			return Permanent(err)
+		}
+		if err := gz.Close(); err != nil {
+			return Permanent(err)
+		}
+	} else {
+		body.Write(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.Endpoint, body)
+	if err != nil {
+		return Permanent(err)
+	}
+	for key, value := range s.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.opts.Compression == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export logs: %w", err)
+	}
+	defer res.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	switch {
+	case res.StatusCode < 300:
+		return nil
+	// Statuses the OTLP specification marks as retryable
+	case res.StatusCode == http.StatusTooManyRequests, res.StatusCode == http.StatusBadGateway,
+		res.StatusCode == http.StatusServiceUnavailable, res.StatusCode == http.StatusGatewayTimeout:
+		return fmt.Errorf("log export failed: %s: %s", res.Status, respBody)
+	default:
+		return Permanent(fmt.Errorf("log export rejected: %s: %s", res.Status, respBody))
+	}
+}
@@ -0,0 +1,236 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// An export request received by the test OTLP receiver, decoded
+type otlpRequest struct {
+	header http.Header
+	logs   *logspb.LogsData
+}
+
+// Stand-in for a collector's OTLP/HTTP logs receiver. Decodes each export
+// request according to its content type, after failing the first few requests
+// with a retryable status
+type otlpReceiver struct {
+	*httptest.Server
+	requests received[otlpRequest]
+	failures atomic.Int32
+}
+
+func mkOTLPReceiver(t *testing.T) *otlpReceiver {
+	srv := &otlpReceiver{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if srv.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		payload, err := io.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		logsData := &logspb.LogsData{}
+		switch r.Header.Get("Content-Type") {
+		case "application/x-protobuf":
+			err = proto.Unmarshal(payload, logsData)
+		case "application/json":
+			err = protojson.Unmarshal(payload, logsData)
+		default:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.requests.add(otlpRequest{header: r.Header.Clone(), logs: logsData})
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newOTLPTestHandler(t *testing.T, otlpCfg config.OTLPOutputConfig, serviceCfg config.ServiceConfig) slog.Handler {
+	otlpCfg.Batch = testBatchConfig(otlpCfg.Batch)
+	handler, err := handlers.NewOTLPHandler(otlpCfg, serviceCfg, &slog.HandlerOptions{Level: slog.LevelDebug})
+	if err != nil {
+		t.Fatalf("Failed to construct OTLP handler: %v", err)
+	}
+	return handler
+}
+
+func findOTLPAttr(attrs []*commonpb.KeyValue, key string) *commonpb.AnyValue {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// Ensure that records are exported in batches over OTLP/HTTP protobuf, with
+// severities, attributes, groups and resource attributes converted to OTLP
+func TestOTLPHandlerProtobuf(t *testing.T) {
+	srv := mkOTLPReceiver(t)
+	srv.failures.Store(1)
+	otlpHandler := newOTLPTestHandler(t, config.OTLPOutputConfig{
+		Endpoint:    srv.URL + "/v1/logs",
+		Protocol:    handlers.OTLPProtocolProtobuf,
+		Compression: "gzip",
+		Headers:     map[string]string{"X-Scope-OrgID": "chtc"},
+		Batch:       config.BatchConfig{MaxBatchSize: 3},
+	}, config.ServiceConfig{
+		Name:               "test-service",
+		Version:            "1.2.3",
+		ResourceAttributes: map[string]string{"host.name": "ap40"},
+	})
+	log := slog.New(otlpHandler)
+
+	log.Debug(testMsg)
+	log.With("job", 42).WithGroup("transfer").Warn(testMsg2, slog.String("url", "osdf:///foo"), slog.Float64("rate", 1.5))
+	log.Error(testMsg, slog.Bool("fatal", true))
+
+	stats := waitForBatchStats(t, otlpHandler, 3)
+	if stats.RecordsSucceeded != 3 || stats.BatchesSucceeded != 1 {
+		t.Fatalf("Expected 3 records exported in 1 batch, got %+v", stats)
+	}
+
+	requests := srv.requests.all()
+	if len(requests) != 1 || len(requests[0].logs.ResourceLogs) != 1 {
+		t.Fatalf("Expected 1 export request with 1 resource, got %v", requests)
+	}
+	if requests[0].header.Get("X-Scope-OrgID") != "chtc" {
+		t.Fatalf("Expected configured header to be sent, got %v", requests[0].header)
+	}
+
+	resourceLogs := requests[0].logs.ResourceLogs[0]
+	for key, expected := range map[string]string{"service.name": "test-service", "service.version": "1.2.3", "host.name": "ap40"} {
+		if value := findOTLPAttr(resourceLogs.Resource.Attributes, key); value.GetStringValue() != expected {
+			t.Fatalf("Expected resource attribute %v=%v, got %v", key, expected, value)
+		}
+	}
+
+	records := resourceLogs.ScopeLogs[0].LogRecords
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 log records, got %v", len(records))
+	}
+	expectedSeverities := []logspb.SeverityNumber{
+		logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+		logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+		logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	}
+	for i, record := range records {
+		if record.SeverityNumber != expectedSeverities[i] {
+			t.Fatalf("Expected record %v to have severity %v, got %v", i, expectedSeverities[i], record.SeverityNumber)
+		}
+		if record.TimeUnixNano == 0 || record.ObservedTimeUnixNano == 0 {
+			t.Fatalf("Expected record %v to have timestamps set", i)
+		}
+	}
+
+	warn := records[1]
+	if warn.SeverityText != "WARN" || warn.Body.GetStringValue() != testMsg2 {
+		t.Fatalf("Unexpected severity text or body: %v %v", warn.SeverityText, warn.Body)
+	}
+	if findOTLPAttr(warn.Attributes, "job").GetIntValue() != 42 {
+		t.Fatalf("Expected integer attribute job=42, got %v", warn.Attributes)
+	}
+	transfer := findOTLPAttr(warn.Attributes, "transfer").GetKvlistValue()
+	if findOTLPAttr(transfer.GetValues(), "url").GetStringValue() != "osdf:///foo" ||
+		findOTLPAttr(transfer.GetValues(), "rate").GetDoubleValue() != 1.5 {
+		t.Fatalf("Expected grouped attributes under transfer, got %v", warn.Attributes)
+	}
+	if !findOTLPAttr(records[2].Attributes, "fatal").GetBoolValue() {
+		t.Fatalf("Expected boolean attribute fatal=true, got %v", records[2].Attributes)
+	}
+}
+
+// Ensure that records can be exported with the OTLP/HTTP JSON encoding, and that
+// rejected requests are not retried
+func TestOTLPHandlerJSON(t *testing.T) {
+	srv := mkOTLPReceiver(t)
+	otlpHandler := newOTLPTestHandler(t, config.OTLPOutputConfig{
+		Endpoint: srv.URL + "/v1/logs",
+		Protocol: handlers.OTLPProtocolJSON,
+		Batch:    config.BatchConfig{MaxBatchSize: 1},
+	}, config.ServiceConfig{Name: "test-service"})
+	log := slog.New(otlpHandler)
+
+	log.Info(testMsg)
+	waitForBatchStats(t, otlpHandler, 1)
+	requests := srv.requests.all()
+	if len(requests) != 1 || requests[0].header.Get("Content-Encoding") != "" {
+		t.Fatalf("Expected 1 uncompressed export request, got %v", len(requests))
+	}
+	record := requests[0].logs.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.Body.GetStringValue() != testMsg || record.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_INFO {
+		t.Fatalf("Unexpected log record %v", record)
+	}
+
+	// A request to an unknown path is rejected outright
+	badHandler := newOTLPTestHandler(t, config.OTLPOutputConfig{
+		Endpoint: srv.URL + "/v1/traces",
+		Protocol: handlers.OTLPProtocolJSON,
+		Batch:    config.BatchConfig{MaxBatchSize: 1},
+	}, config.ServiceConfig{})
+	slog.New(badHandler).Info(testMsg)
+	if stats := waitForBatchStats(t, badHandler, 1); stats.RecordsFailed != 1 || stats.BatchesFailed != 1 {
+		t.Fatalf("Expected 1 failed batch, got %+v", stats)
+	}
+
+	if err := otlpHandler.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error closing handler: %v", err)
+	}
+	// The rejection hasn't been reported yet, so it's returned on close
+	if err := badHandler.(io.Closer).Close(); err == nil {
+		t.Fatal("Expected the rejected export to be reported on close")
+	}
+}
@@ -0,0 +1,194 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// A single log record to be published to a message queue
+type QueueMessage struct {
+	// Key used by the queue to choose a partition, or nil to spread messages evenly
+	Key []byte
+	// The record as formatted by the writing handler
+	Value []byte
+	// Time the record was logged
+	Time time.Time
+}
+
+// Interface for message queues that log records can be published to
+type QueueSink interface {
+	// Publish delivers a batch of messages, returning once the queue has
+	// acknowledged them. A *PublishError reports which messages may be retried,
+	// while an error marked with Permanent is not retried at all
+	Publish(ctx context.Context, messages []QueueMessage) error
+	Close() error
+}
+
+// Error returned by a QueueSink that could not publish every message in a batch.
+// Messages in Retry failed with a transient error and may be published again,
+// while Failed counts messages that were rejected outright
+type PublishError struct {
+	Retry  []QueueMessage
+	Failed int
+	Err    error
+}
+
+func (p *PublishError) Error() string {
+	return p.Err.Error()
+}
+
+func (p *PublishError) Unwrap() error {
+	return p.Err
+}
+
+// Handler that wraps another slog handler, publishing its output to a message
+// queue in batches
+type QueueHandler struct {
+	formatter recordFormatter
+	keyAttr   string
+	sink      QueueSink
+	batcher   *batcher[QueueMessage]
+}
+
+// Construct a new message queue log handler.
+// Upon logging a message, passes the log record to the handler supplied by supplyHandler,
+// then queues the result to be published to sink. If the output's key attribute is
+// set, its value is used as the message key
+func NewQueueHandler(queueOpts config.QueueOutputConfig, sink QueueSink, supplyHandler HandlerSupplier) slog.Handler {
+	handler := &QueueHandler{
+		formatter: newRecordFormatter(supplyHandler),
+		keyAttr:   queueOpts.KeyAttribute,
+		sink:      sink,
+	}
+	handler.batcher = newBatcher(queueOpts.Batch, handler.publish)
+	return handler
+}
+
+// Construct the queue sink named by the output's type
+func NewQueueSink(queueOpts config.QueueOutputConfig) (QueueSink, error) {
+	switch queueOpts.Type {
+	case "kafka":
+		return NewKafkaSink(queueOpts.Kafka)
+	default:
+		return nil, fmt.Errorf("unsupported queue output type %q", queueOpts.Type)
+	}
+}
+
+func (q *QueueHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return q.formatter.enabled(ctx, level)
+}
+
+// Required by slog.Handler interface: Processes a log via the writing handler, then
+// queues the result for publishing. Returns any errors from previously failed publishes
+func (q *QueueHandler) Handle(ctx context.Context, r slog.Record) error {
+	payload, err := q.formatter.format(ctx, r)
+	if err != nil {
+		return err
+	}
+	message := QueueMessage{Value: payload, Time: r.Time}
+	if q.keyAttr != "" {
+		fields, err := decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		if key, ok := fields[q.keyAttr]; ok {
+			message.Key = []byte(fmt.Sprint(key))
+		}
+	}
+	return q.batcher.add(message)
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (q *QueueHandler) WithGroup(name string) slog.Handler {
+	return &QueueHandler{formatter: q.formatter.withGroup(name), keyAttr: q.keyAttr, sink: q.sink, batcher: q.batcher}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (q *QueueHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &QueueHandler{formatter: q.formatter.withAttrs(attrs), keyAttr: q.keyAttr, sink: q.sink, batcher: q.batcher}
+}
+
+// BatchStats reports the handler's delivery statistics
+func (q *QueueHandler) BatchStats() BatchStats {
+	return q.batcher.batchStats()
+}
+
+// BytesWritten reports the number of bytes of formatted records the handler has accepted
+func (q *QueueHandler) BytesWritten() uint64 {
+	return q.formatter.bytesWritten()
+}
+
+// Close publishes any queued records, then closes the sink
+func (q *QueueHandler) Close() error {
+	return errors.Join(q.batcher.close(), q.sink.Close())
+}
+
+// publish hands a batch to the sink, translating partial failures for the batcher
+func (q *QueueHandler) publish(ctx context.Context, batch []QueueMessage) error {
+	err := q.sink.Publish(ctx, batch)
+	var publishErr *PublishError
+	if errors.As(err, &publishErr) {
+		return &partialFailure[QueueMessage]{retry: publishErr.Retry, failed: publishErr.Failed, err: publishErr.Err}
+	}
+	return err
+}
+
+// In-memory QueueSink, which keeps every published message. Useful for tests
+// and for applications that consume log records themselves
+type MemoryQueueSink struct {
+	mu       sync.Mutex
+	messages []QueueMessage
+	closed   bool
+}
+
+func NewMemoryQueueSink() *MemoryQueueSink {
+	return &MemoryQueueSink{}
+}
+
+func (m *MemoryQueueSink) Publish(_ context.Context, messages []QueueMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Permanent(errors.New("queue sink is closed"))
+	}
+	m.messages = append(m.messages, messages...)
+	return nil
+}
+
+// Messages returns a copy of every message published so far
+func (m *MemoryQueueSink) Messages() []QueueMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]QueueMessage{}, m.messages...)
+}
+
+func (m *MemoryQueueSink) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
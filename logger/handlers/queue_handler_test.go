@@ -0,0 +1,108 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+func newQueueTestHandler(t *testing.T, queueCfg config.QueueOutputConfig, sink handlers.QueueSink) slog.Handler {
+	queueCfg.Batch = testBatchConfig(queueCfg.Batch)
+	return handlers.NewQueueHandler(queueCfg, sink, newJSONTestHandler)
+}
+
+// Ensure that records are published in batches, keyed by the configured attribute
+func TestQueueHandlerMemorySink(t *testing.T) {
+	sink := handlers.NewMemoryQueueSink()
+	queueHandler := newQueueTestHandler(t, config.QueueOutputConfig{
+		KeyAttribute: "job",
+		Batch:        config.BatchConfig{MaxBatchSize: 2},
+	}, sink)
+	log := slog.New(queueHandler)
+
+	log.Info(testMsg, slog.Int("job", 42))
+	log.Warn(testMsg2)
+	waitForBatchStats(t, queueHandler, 2)
+
+	messages := sink.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 published messages, got %v", len(messages))
+	}
+	if string(messages[0].Key) != "42" || messages[1].Key != nil {
+		t.Fatalf("Expected only the first message to be keyed by job, got %q and %q", messages[0].Key, messages[1].Key)
+	}
+	record := map[string]any{}
+	if err := json.Unmarshal(messages[1].Value, &record); err != nil || record["msg"] != testMsg2 {
+		t.Fatalf("Expected message value to be the record JSON, got %s", messages[1].Value)
+	}
+	if messages[0].Time.IsZero() {
+		t.Fatal("Expected message time to be set")
+	}
+
+	if err := queueHandler.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error closing handler: %v", err)
+	}
+	if err := sink.Publish(context.Background(), messages); err == nil {
+		t.Fatal("Expected the sink to be closed along with the handler")
+	}
+}
+
+// QueueSink that fails every publish with the given error, counting the attempts
+type failingQueueSink struct {
+	err      error
+	attempts atomic.Int32
+}
+
+func (f *failingQueueSink) Publish(_ context.Context, _ []handlers.QueueMessage) error {
+	f.attempts.Add(1)
+	return f.err
+}
+
+func (f *failingQueueSink) Close() error {
+	return nil
+}
+
+// Ensure that sinks can mark errors as permanent, so the batch is not retried
+func TestQueueHandlerPermanentError(t *testing.T) {
+	for _, sinkErr := range []error{
+		handlers.Permanent(errors.New("message too large")),
+		fmt.Errorf("%w: topic does not exist", handlers.ErrPermanent),
+	} {
+		sink := &failingQueueSink{err: sinkErr}
+		queueHandler := newQueueTestHandler(t, config.QueueOutputConfig{
+			Batch: config.BatchConfig{MaxBatchSize: 1},
+		}, sink)
+		slog.New(queueHandler).Info(testMsg)
+
+		stats := waitForBatchStats(t, queueHandler, 1)
+		if stats.RecordsFailed != 1 || sink.attempts.Load() != 1 {
+			t.Fatalf("Expected 1 failed record after 1 attempt for %q, got %v after %v", sinkErr, stats, sink.attempts.Load())
+		}
+		queueHandler.(io.Closer).Close()
+	}
+}
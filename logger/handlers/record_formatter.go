@@ -0,0 +1,113 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// recordFormatter wraps a writing slog handler whose output is captured in a
+// shared buffer, so that a forwarding handler can post-process each formatted
+// record before sending it elsewhere
+type recordFormatter struct {
+	handler slog.Handler
+	buf     *bytes.Buffer
+	mu      *sync.Mutex
+	// Bytes of records formatted by this formatter and those derived from it
+	written *atomic.Uint64
+}
+
+func newRecordFormatter(supplyHandler HandlerSupplier) recordFormatter {
+	buf := &bytes.Buffer{}
+	return recordFormatter{
+		handler: supplyHandler(buf),
+		buf:     buf,
+		mu:      &sync.Mutex{},
+		written: &atomic.Uint64{},
+	}
+}
+
+func (f recordFormatter) enabled(ctx context.Context, level slog.Level) bool {
+	return f.handler.Enabled(ctx, level)
+}
+
+// format writes the record via the child handler, then returns a copy of the
+// output with any trailing newline removed
+func (f recordFormatter) format(ctx context.Context, r slog.Record) ([]byte, error) {
+	// Must be thread-safe, need to write to a buffer then immediately read back
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer f.buf.Reset()
+
+	if err := f.handler.Handle(ctx, r); err != nil {
+		return nil, err
+	}
+	payload := bytes.Clone(bytes.TrimSuffix(f.buf.Bytes(), []byte("\n")))
+	f.written.Add(uint64(len(payload)))
+	return payload, nil
+}
+
+func (f recordFormatter) bytesWritten() uint64 {
+	return f.written.Load()
+}
+
+func (f recordFormatter) withGroup(name string) recordFormatter {
+	return recordFormatter{handler: f.handler.WithGroup(name), buf: f.buf, mu: f.mu, written: f.written}
+}
+
+func (f recordFormatter) withAttrs(attrs []slog.Attr) recordFormatter {
+	return recordFormatter{handler: f.handler.WithAttrs(attrs), buf: f.buf, mu: f.mu, written: f.written}
+}
+
+// decodeRecord parses a JSON-formatted record back into a map, keeping integer
+// attributes as integers rather than converting them to floats
+func decodeRecord(payload []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	record := map[string]any{}
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	return convertNumbers(record).(map[string]any), nil
+}
+
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, child := range v {
+			v[key] = convertNumbers(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = convertNumbers(child)
+		}
+	}
+	return value
+}
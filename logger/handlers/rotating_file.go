@@ -0,0 +1,687 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package handlers
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/robfig/cron/v3"
+)
+
+// Default layout for the timestamp in rotated file names, matching lumberjack's backups
+const defaultRotationTimeFormat = "2006-01-02T15-04-05.000"
+
+// Signals the log file may be reopened on
+var reopenSignals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// Extension added to rotated files by each compression algorithm
+var compressionExtensions = map[string]string{
+	"":     "",
+	"none": "",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// RotatingFile is a writer for a log file that is rotated once it reaches its maximum
+// size, on an interval or cron schedule, on SIGHUP, or when Rotate is called.
+// Rotated files are renamed with a timestamp, then compressed and removed once there
+// are too many or they are too old, in the background. Errors from the background
+// are passed to the rotation's OnError hook if it is set, and otherwise returned by Close.
+// The file is also reopened if it is moved or truncated by another tool such as logrotate,
+// or on the configured reopen signal
+type RotatingFile struct {
+	opts     config.FileOutputConfig
+	location *time.Location
+	schedule cron.Schedule
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	uid, gid int
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+	lastCheck    time.Time
+	closed       bool
+
+	// Rotated files waiting to be compressed and cleaned up. Queued without blocking,
+	// so writes never wait on the background processing
+	pendingMu     sync.Mutex
+	pendingCond   *sync.Cond
+	pending       []string
+	pendingClosed bool
+
+	signals       chan os.Signal
+	reopenSignals chan os.Signal
+	background    sync.WaitGroup
+
+	// Errors from the background, kept for Close if there is no OnError hook
+	errMu sync.Mutex
+	errs  []error
+}
+
+// Number of background errors kept for Close, dropping the oldest
+const maxBackgroundErrors = 16
+
+// Construct a new rotating file writer for the file output described by fileOpts,
+// creating any missing parent directories. The file is opened when it is first written to,
+// which reports any failure to create the directories
+func NewRotatingFile(fileOpts config.FileOutputConfig) (*RotatingFile, error) {
+	if fileOpts.FilePath == "" {
+		return nil, errors.New("file output enabled but file path is empty")
+	}
+	fileMode, err := parseFileMode(fileOpts.FileMode, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file mode: %w", err)
+	}
+	dirMode, err := parseFileMode(fileOpts.DirMode, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory mode: %w", err)
+	}
+	uid, gid, err := lookupOwnership(fileOpts.Owner, fileOpts.Group)
+	if err != nil {
+		return nil, err
+	}
+	var reopenSignal os.Signal
+	if fileOpts.Reopen.Signal != "" {
+		name := strings.ToUpper(fileOpts.Reopen.Signal)
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		if reopenSignal = reopenSignals[name]; reopenSignal == nil {
+			return nil, fmt.Errorf("unsupported reopen signal %q", fileOpts.Reopen.Signal)
+		}
+		if reopenSignal == syscall.SIGHUP && fileOpts.Rotation.OnSIGHUP {
+			return nil, errors.New("reopen signal must not be SIGHUP when rotating on SIGHUP")
+		}
+	}
+	rotation := &fileOpts.Rotation
+	if _, ok := compressionExtensions[rotation.Compression]; !ok {
+		return nil, fmt.Errorf("unsupported rotated file compression %q", rotation.Compression)
+	}
+	if rotation.TimeFormat == "" {
+		rotation.TimeFormat = defaultRotationTimeFormat
+	}
+
+	r := &RotatingFile{
+		opts:     fileOpts,
+		location: time.UTC,
+		fileMode: fileMode,
+		dirMode:  dirMode,
+		uid:      uid,
+		gid:      gid,
+	}
+	r.pendingCond = sync.NewCond(&r.pendingMu)
+	if rotation.LocalTime {
+		r.location = time.Local
+	}
+
+	switch rotation.Mode {
+	case "", "size":
+	case "interval":
+		if rotation.Interval <= 0 {
+			return nil, errors.New("interval rotation requires a positive interval")
+		}
+	case "schedule":
+		spec := rotation.Schedule
+		if !rotation.LocalTime && !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+			spec = "CRON_TZ=UTC " + spec
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotation schedule %q: %w", rotation.Schedule, err)
+		}
+		r.schedule = schedule
+	default:
+		return nil, fmt.Errorf("unknown rotation mode %q", rotation.Mode)
+	}
+	r.nextRotation = r.next(time.Now())
+	// Failing to create the directory now is reported by the first write, which tries again
+	_ = r.createDirs()
+
+	r.background.Add(1)
+	go r.processRotated()
+
+	if rotation.OnSIGHUP {
+		r.signals = make(chan os.Signal, 1)
+		signal.Notify(r.signals, syscall.SIGHUP)
+		r.background.Add(1)
+		go r.watchSignals(r.signals, r.Rotate)
+	}
+	if reopenSignal != nil {
+		r.reopenSignals = make(chan os.Signal, 1)
+		signal.Notify(r.reopenSignals, reopenSignal)
+		r.background.Add(1)
+		go r.watchSignals(r.reopenSignals, r.Reopen)
+	}
+	return r, nil
+}
+
+// Write writes p to the current log file, rotating it first if it is due
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	maxSize := int64(r.opts.MaxFileSize) * 1024 * 1024
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	} else if interval := r.opts.Reopen.CheckInterval; interval > 0 && now.Sub(r.lastCheck) >= interval {
+		if err := r.checkMoved(); err != nil {
+			return 0, err
+		}
+		r.lastCheck = now
+	}
+	dueByTime := !r.nextRotation.IsZero() && !now.Before(r.nextRotation)
+	dueBySize := maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > maxSize
+	if dueByTime || dueBySize {
+		if err := r.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the log file immediately, if it has been written to
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file == nil {
+		if _, err := os.Stat(r.opts.FilePath); err != nil {
+			return nil
+		}
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	return r.rotate(time.Now())
+}
+
+// Reopen closes the log file and opens the file at its path again, for when it has
+// been moved aside by another tool
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return errors.Join(err, r.open())
+}
+
+// Close closes the log file, waiting for any rotated files to be compressed and cleaned up
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	for _, signals := range []chan os.Signal{r.signals, r.reopenSignals} {
+		if signals != nil {
+			signal.Stop(signals)
+			close(signals)
+		}
+	}
+	r.pendingMu.Lock()
+	r.pendingClosed = true
+	r.pendingCond.Broadcast()
+	r.pendingMu.Unlock()
+	r.mu.Unlock()
+
+	r.background.Wait()
+	return errors.Join(err, r.takeErrors())
+}
+
+// open opens the log file for appending, creating it and its directory if necessary
+func (r *RotatingFile) open() error {
+	if err := r.createDirs(); err != nil {
+		return err
+	}
+	file, err := r.createFile(r.opts.FilePath, os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.lastCheck = time.Now()
+	return nil
+}
+
+// createFile opens a file for writing with the given extra flags, giving it the
+// configured permissions and ownership if it is created
+func (r *RotatingFile) createFile(name string, flags int) (*os.File, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|flags, r.fileMode)
+	for os.IsExist(err) {
+		// Already exists, so is opened as it is, unless removed again in the meantime
+		if file, err = os.OpenFile(name, os.O_WRONLY|flags, 0); !os.IsNotExist(err) {
+			return file, err
+		}
+		file, err = os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|flags, r.fileMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Permissions are set explicitly, as the mode passed when creating is masked by the umask
+	err = file.Chmod(r.fileMode)
+	if err == nil && (r.uid != -1 || r.gid != -1) {
+		err = file.Chown(r.uid, r.gid)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// createDirs creates any missing parent directories of the log file, with the
+// configured permissions and ownership
+func (r *RotatingFile) createDirs() (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("unable to create log directory: %w", err)
+		}
+	}()
+	var missing []string
+	for dir := filepath.Dir(r.opts.FilePath); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], r.dirMode); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := os.Chmod(missing[i], r.dirMode); err != nil {
+			return err
+		}
+		if r.uid != -1 || r.gid != -1 {
+			if err := os.Chown(missing[i], r.uid, r.gid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkMoved reopens the log file if it has been moved or removed, and picks up
+// its size if it has been truncated. Must be called with mu held
+func (r *RotatingFile) checkMoved() error {
+	openInfo, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	pathInfo, err := os.Stat(r.opts.FilePath)
+	if err != nil || !os.SameFile(openInfo, pathInfo) {
+		err = r.file.Close()
+		r.file = nil
+		return errors.Join(err, r.open())
+	}
+	if openInfo.Size() < r.size {
+		// Truncated in place, as by logrotate's copytruncate; writes continue from
+		// the new end of the file as it was opened for appending
+		r.size = openInfo.Size()
+	}
+	return nil
+}
+
+// rotate moves the current log file aside and opens a new one, unless nothing has
+// been written to it. Must be called with mu held
+func (r *RotatingFile) rotate(now time.Time) error {
+	r.nextRotation = r.next(now)
+	if r.size == 0 {
+		return nil
+	}
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	rotatedPath := r.rotatedName(now)
+	if err := os.Rename(r.opts.FilePath, rotatedPath); err == nil {
+		r.queueRotated(rotatedPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+// queueRotated queues a rotated file for processRotated without waiting for it
+func (r *RotatingFile) queueRotated(rotatedPath string) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	r.pending = append(r.pending, rotatedPath)
+	r.pendingCond.Signal()
+}
+
+// nextRotated waits for the next rotated file to process, returning false once the
+// writer is closed and every queued file has been processed
+func (r *RotatingFile) nextRotated() (string, bool) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	for len(r.pending) == 0 && !r.pendingClosed {
+		r.pendingCond.Wait()
+	}
+	if len(r.pending) == 0 {
+		return "", false
+	}
+	rotatedPath := r.pending[0]
+	r.pending = r.pending[1:]
+	return rotatedPath, true
+}
+
+// next returns the time of the next time-based rotation after now, if any
+func (r *RotatingFile) next(now time.Time) time.Time {
+	switch {
+	case r.schedule != nil:
+		return r.schedule.Next(now)
+	case r.opts.Rotation.Mode == "interval":
+		local := now.In(r.location)
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, r.location)
+		interval := r.opts.Rotation.Interval
+		return day.Add((now.Sub(day)/interval + 1) * interval)
+	}
+	return time.Time{}
+}
+
+// rotatedName returns the name of the log file once rotated at the given time,
+// such as app-2006-01-02T15-04-05.000.log for app.log. If a file was already rotated
+// with the same timestamp, a counter is added so it is not overwritten, as in
+// app-2006-01-02T15-04-05.000.1.log
+func (r *RotatingFile) rotatedName(t time.Time) string {
+	dir, base := filepath.Split(r.opts.FilePath)
+	ext := filepath.Ext(base)
+	stamp := strings.TrimSuffix(base, ext) + "-" + t.In(r.location).Format(r.opts.Rotation.TimeFormat)
+	name := filepath.Join(dir, stamp+ext)
+	for counter := 1; r.rotatedExists(name); counter++ {
+		name = filepath.Join(dir, stamp+"."+strconv.Itoa(counter)+ext)
+	}
+	return name
+}
+
+// rotatedExists reports whether a rotated file exists with the given name, either
+// as it was renamed or once compressed
+func (r *RotatingFile) rotatedExists(name string) bool {
+	for _, compressedExt := range []string{"", ".gz", ".zst"} {
+		if _, err := os.Lstat(name + compressedExt); err == nil || !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchSignals calls action whenever a signal is received, until signals is closed
+func (r *RotatingFile) watchSignals(signals chan os.Signal, action func() error) {
+	defer r.background.Done()
+	for range signals {
+		if err := action(); err != nil && !errors.Is(err, os.ErrClosed) {
+			r.addError(err)
+		}
+	}
+}
+
+// processRotated compresses each rotated file, removes old rotated files, then calls
+// the post-rotation hook
+func (r *RotatingFile) processRotated() {
+	defer r.background.Done()
+	for {
+		rotatedPath, ok := r.nextRotated()
+		if !ok {
+			return
+		}
+		finalPath, err := r.compress(rotatedPath)
+		if err != nil {
+			r.addError(fmt.Errorf("failed to compress rotated log file %s: %w", rotatedPath, err))
+		}
+		if err := r.removeOldFiles(); err != nil {
+			r.addError(fmt.Errorf("failed to remove old log files: %w", err))
+		}
+		if r.opts.Rotation.PostRotate != nil {
+			r.opts.Rotation.PostRotate(finalPath)
+		}
+	}
+}
+
+// compress compresses a rotated file, returning the path of the compressed file
+func (r *RotatingFile) compress(rotatedPath string) (string, error) {
+	compression := r.opts.Rotation.Compression
+	if compressionExtensions[compression] == "" {
+		return rotatedPath, nil
+	}
+	compressedPath := rotatedPath + compressionExtensions[compression]
+
+	src, err := os.Open(rotatedPath)
+	if err != nil {
+		return rotatedPath, err
+	}
+	defer src.Close()
+	dst, err := r.createFile(compressedPath, os.O_TRUNC)
+	if err != nil {
+		return rotatedPath, err
+	}
+
+	var writer io.WriteCloser
+	if compression == "zstd" {
+		writer, err = zstd.NewWriter(dst)
+		if err != nil {
+			dst.Close()
+			return rotatedPath, err
+		}
+	} else {
+		writer = gzip.NewWriter(dst)
+	}
+	_, err = io.Copy(writer, src)
+	err = errors.Join(err, writer.Close(), dst.Close())
+	if err != nil {
+		os.Remove(compressedPath)
+		return rotatedPath, err
+	}
+	return compressedPath, os.Remove(rotatedPath)
+}
+
+// removeOldFiles removes rotated files beyond the number of backups to keep, or
+// older than the maximum age
+func (r *RotatingFile) removeOldFiles() error {
+	if r.opts.MaxBackups <= 0 && r.opts.MaxAgeDays <= 0 {
+		return nil
+	}
+	dir, base := filepath.Split(r.opts.FilePath)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type rotatedFile struct {
+		name    string
+		time    time.Time
+		counter int
+	}
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		for _, compressedExt := range []string{".gz", ".zst"} {
+			stamp = strings.TrimSuffix(stamp, compressedExt)
+		}
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ext)
+		rotatedAt, err := time.ParseInLocation(r.opts.Rotation.TimeFormat, stamp, r.location)
+		counter := 0
+		if err != nil {
+			// Rotated more than once with the same timestamp, with a counter after it
+			dot := strings.LastIndexByte(stamp, '.')
+			if dot < 0 {
+				continue
+			}
+			if counter, err = strconv.Atoi(stamp[dot+1:]); err != nil || counter < 1 {
+				continue
+			}
+			if rotatedAt, err = time.ParseInLocation(r.opts.Rotation.TimeFormat, stamp[:dot], r.location); err != nil {
+				continue
+			}
+		}
+		files = append(files, rotatedFile{name: name, time: rotatedAt, counter: counter})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].time.Equal(files[j].time) {
+			return files[i].counter > files[j].counter
+		}
+		return files[i].time.After(files[j].time)
+	})
+
+	cutoff := time.Now().Add(-time.Duration(r.opts.MaxAgeDays) * 24 * time.Hour)
+	var errs []error
+	for i, file := range files {
+		tooMany := r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups
+		tooOld := r.opts.MaxAgeDays > 0 && file.time.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(filepath.Join(dir, file.name)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseFileMode parses permissions given in octal, such as "0640" or "1777". The setuid,
+// setgid and sticky bits are mapped to their os.FileMode flags, which Chmod expects
+func parseFileMode(mode string, defaultMode os.FileMode) (os.FileMode, error) {
+	if mode == "" {
+		return defaultMode, nil
+	}
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || parsed > 0o7777 {
+		return 0, fmt.Errorf("%q is not an octal file mode", mode)
+	}
+	fileMode := os.FileMode(parsed & 0o777)
+	if parsed&0o4000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if parsed&0o2000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if parsed&0o1000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+	return fileMode, nil
+}
+
+// lookupOwnership resolves user and group names or IDs, returning -1 for those not given
+func lookupOwnership(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown log file owner: %w", err)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown log file group: %w", err)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// addError reports an error from the background to the OnError hook, or keeps it for Close
+func (r *RotatingFile) addError(err error) {
+	if r.opts.Rotation.OnError != nil {
+		r.opts.Rotation.OnError(err)
+		return
+	}
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	if len(r.errs) == maxBackgroundErrors {
+		r.errs = r.errs[1:]
+	}
+	r.errs = append(r.errs, err)
+}
+
+func (r *RotatingFile) takeErrors() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	err := errors.Join(r.errs...)
+	r.errs = nil
+	return err
+}
@@ -0,0 +1,407 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newRotatingTestFile(t *testing.T, fileCfg config.FileOutputConfig) (*handlers.RotatingFile, chan string) {
+	rotated := make(chan string, 10)
+	fileCfg.Rotation.PostRotate = func(rotatedPath string) {
+		rotated <- rotatedPath
+	}
+	file, err := handlers.NewRotatingFile(fileCfg)
+	if err != nil {
+		t.Fatalf("Failed to construct rotating file: %v", err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file, rotated
+}
+
+func waitForRotation(t *testing.T, rotated chan string) string {
+	select {
+	case rotatedPath := <-rotated:
+		return rotatedPath
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the log file to be rotated")
+		return ""
+	}
+}
+
+// Ensure that the log file is rotated once it reaches its maximum size, with rotated
+// files compressed and only the configured number of backups kept
+func TestRotatingFileSize(t *testing.T) {
+	dir := t.TempDir()
+	file, rotated := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath:    path.Join(dir, "app.log"),
+		MaxFileSize: 1,
+		MaxBackups:  2,
+		Rotation: config.FileRotationConfig{
+			Compression: "zstd",
+			TimeFormat:  "2006-01-02T15-04-05.000000000",
+		},
+	})
+
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 4; i++ {
+		chunk[0] = byte('a' + i)
+		if _, err := file.Write(chunk); err != nil {
+			t.Fatalf("Failed to write to log file: %v", err)
+		}
+	}
+	var rotatedPaths []string
+	for i := 0; i < 3; i++ {
+		rotatedPaths = append(rotatedPaths, waitForRotation(t, rotated))
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Unexpected error closing log file: %v", err)
+	}
+
+	// The first record has been rotated out and removed
+	backups, _ := filepath.Glob(path.Join(dir, "app-*.log.zst"))
+	if len(backups) != 2 || backups[0] != rotatedPaths[1] || backups[1] != rotatedPaths[2] {
+		t.Fatalf("Expected the 2 newest rotated files to be kept, got %v of %v", backups, rotatedPaths)
+	}
+	compressed, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatalf("Unable to open rotated file: %v", err)
+	}
+	defer compressed.Close()
+	decoder, err := zstd.NewReader(compressed)
+	if err != nil {
+		t.Fatalf("Unable to decompress rotated file: %v", err)
+	}
+	defer decoder.Close()
+	if content, _ := io.ReadAll(decoder); len(content) != len(chunk) || content[0] != 'c' {
+		t.Fatalf("Expected the third record in the newest rotated file, got %d bytes", len(content))
+	}
+	if current, _ := os.ReadFile(path.Join(dir, "app.log")); len(current) != len(chunk) || current[0] != 'd' {
+		t.Fatalf("Expected only the last record in the current log file, got %d bytes", len(current))
+	}
+}
+
+// Ensure that the log file is rotated at each interval, aligned to the clock
+func TestRotatingFileInterval(t *testing.T) {
+	dir := t.TempDir()
+	file, rotated := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: path.Join(dir, "app.log"),
+		Rotation: config.FileRotationConfig{
+			Mode:        "interval",
+			Interval:    time.Second,
+			Compression: "none",
+		},
+	})
+
+	file.Write([]byte(testMsg + "\n"))
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	file.Write([]byte(testMsg2 + "\n"))
+
+	rotatedPath := waitForRotation(t, rotated)
+	if content, _ := os.ReadFile(rotatedPath); string(content) != testMsg+"\n" {
+		t.Fatalf("Expected the first record in the rotated file, got %q", content)
+	}
+	if !strings.HasPrefix(path.Base(rotatedPath), "app-"+time.Now().UTC().Format("2006-01-02T")) {
+		t.Fatalf("Expected rotated file name to hold the UTC rotation time, got %v", rotatedPath)
+	}
+}
+
+// Ensure that the log file is rotated on SIGHUP, for logrotate's postrotate scripts
+func TestRotatingFileSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	file, rotated := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: path.Join(dir, "app.log"),
+		Rotation: config.FileRotationConfig{
+			OnSIGHUP:    true,
+			Compression: "gzip",
+		},
+	})
+
+	file.Write([]byte(testMsg + "\n"))
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("Unable to send SIGHUP: %v", err)
+	}
+	rotatedPath := waitForRotation(t, rotated)
+	if !strings.HasSuffix(rotatedPath, ".log.gz") {
+		t.Fatalf("Expected a gzip-compressed rotated file, got %v", rotatedPath)
+	}
+	compressed, err := os.Open(rotatedPath)
+	if err != nil {
+		t.Fatalf("Unable to open rotated file: %v", err)
+	}
+	defer compressed.Close()
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Fatalf("Unable to decompress rotated file: %v", err)
+	}
+	if content, _ := io.ReadAll(gz); string(content) != testMsg+"\n" {
+		t.Fatalf("Expected the record in the rotated file, got %q", content)
+	}
+}
+
+// Ensure that rotating twice with the same timestamp keeps both rotated files,
+// including once they have been compressed, and that both are cleaned up by age
+func TestRotatingFileSameTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	file, rotated := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath:   path.Join(dir, "app.log"),
+		MaxBackups: 2,
+		Rotation: config.FileRotationConfig{
+			Compression: "gzip",
+			TimeFormat:  "2006-01-02",
+		},
+	})
+
+	var rotatedPaths []string
+	for i := 0; i < 3; i++ {
+		file.Write([]byte(strconv.Itoa(i) + "\n"))
+		if err := file.Rotate(); err != nil {
+			t.Fatalf("Failed to rotate log file: %v", err)
+		}
+		rotatedPaths = append(rotatedPaths, waitForRotation(t, rotated))
+	}
+	stamp := "app-" + time.Now().UTC().Format("2006-01-02")
+	expected := []string{stamp + ".log.gz", stamp + ".1.log.gz", stamp + ".2.log.gz"}
+	for i, rotatedPath := range rotatedPaths {
+		if path.Base(rotatedPath) != expected[i] {
+			t.Fatalf("Expected rotated file %v, got %v", expected[i], rotatedPath)
+		}
+	}
+
+	// The oldest rotated file, without a counter, is the one removed
+	backups, _ := filepath.Glob(path.Join(dir, "app-*.log.gz"))
+	if len(backups) != 2 || backups[0] != rotatedPaths[1] || backups[1] != rotatedPaths[2] {
+		t.Fatalf("Expected the 2 newest rotated files to be kept, got %v", backups)
+	}
+	compressed, err := os.Open(rotatedPaths[1])
+	if err != nil {
+		t.Fatalf("Unable to open rotated file: %v", err)
+	}
+	defer compressed.Close()
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Fatalf("Unable to decompress rotated file: %v", err)
+	}
+	if content, _ := io.ReadAll(gz); string(content) != "1\n" {
+		t.Fatalf("Expected the second record in the second rotated file, got %q", content)
+	}
+}
+
+// Ensure that a log file with nothing written since it was last rotated is not rotated again
+func TestRotatingFileSkipsEmpty(t *testing.T) {
+	dir := t.TempDir()
+	file, rotated := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: path.Join(dir, "app.log"),
+		Rotation: config.FileRotationConfig{Compression: "none"},
+	})
+
+	file.Write([]byte(testMsg + "\n"))
+	for i := 0; i < 2; i++ {
+		if err := file.Rotate(); err != nil {
+			t.Fatalf("Failed to rotate log file: %v", err)
+		}
+	}
+	waitForRotation(t, rotated)
+	if backups, _ := filepath.Glob(path.Join(dir, "app-*.log")); len(backups) != 1 {
+		t.Fatalf("Expected only the written log file to be rotated, got %v", backups)
+	}
+}
+
+// Ensure that errors from processing rotated files in the background are passed to
+// the OnError hook, rather than returned from writing unrelated records
+func TestRotatingFileBackgroundErrors(t *testing.T) {
+	dir := t.TempDir()
+	rotated := make(chan string, 10)
+	release := make(chan struct{})
+	errs := make(chan error, 10)
+	file, err := handlers.NewRotatingFile(config.FileOutputConfig{
+		FilePath: path.Join(dir, "app.log"),
+		Rotation: config.FileRotationConfig{
+			Compression: "gzip",
+			// Hold up the background processing until the second rotated file is gone
+			PostRotate: func(rotatedPath string) {
+				rotated <- rotatedPath
+				<-release
+			},
+			OnError: func(err error) { errs <- err },
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to construct rotating file: %v", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte(testMsg + "\n"))
+	file.Rotate()
+	waitForRotation(t, rotated)
+	file.Write([]byte(testMsg2 + "\n"))
+	file.Rotate()
+	uncompressed, _ := filepath.Glob(path.Join(dir, "app-*.log"))
+	if len(uncompressed) != 1 {
+		t.Fatalf("Expected a single rotated file waiting to be compressed, got %v", uncompressed)
+	}
+	os.Remove(uncompressed[0])
+	close(release)
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "failed to compress rotated log file") {
+			t.Fatalf("Expected the compression error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the compression error")
+	}
+	if _, err := file.Write([]byte(testMsg + "\n")); err != nil {
+		t.Fatalf("Expected writing to succeed regardless of the background error, got %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Expected the background error to be reported only to the hook, got %v", err)
+	}
+}
+
+// Ensure that the log file is reopened once it has been moved aside, and that
+// writes continue at the start of a file truncated in place
+func TestRotatingFileMovedOrTruncated(t *testing.T) {
+	dir := t.TempDir()
+	logPath := path.Join(dir, "app.log")
+	file, _ := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: logPath,
+		Reopen:   config.FileReopenConfig{CheckInterval: time.Millisecond},
+	})
+
+	file.Write([]byte(testMsg + "\n"))
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatalf("Unable to move log file: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	file.Write([]byte(testMsg2 + "\n"))
+	if moved, _ := os.ReadFile(logPath + ".1"); string(moved) != testMsg+"\n" {
+		t.Fatalf("Expected only the first record in the moved file, got %q", moved)
+	}
+	if current, _ := os.ReadFile(logPath); string(current) != testMsg2+"\n" {
+		t.Fatalf("Expected the second record in a new log file, got %q", current)
+	}
+
+	// As with logrotate's copytruncate
+	if err := os.Truncate(logPath, 0); err != nil {
+		t.Fatalf("Unable to truncate log file: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	file.Write([]byte(testMsg + "\n"))
+	if current, _ := os.ReadFile(logPath); string(current) != testMsg+"\n" {
+		t.Fatalf("Expected only the third record in the truncated log file, got %q", current)
+	}
+}
+
+// Ensure that the log file is reopened on the configured signal
+func TestRotatingFileReopenSignal(t *testing.T) {
+	dir := t.TempDir()
+	logPath := path.Join(dir, "app.log")
+	file, _ := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: logPath,
+		Reopen:   config.FileReopenConfig{Signal: "USR1"},
+	})
+
+	file.Write([]byte(testMsg + "\n"))
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatalf("Unable to move log file: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("Unable to send SIGUSR1: %v", err)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(logPath); err == nil {
+			break
+		} else if time.Since(start) > 5*time.Second {
+			t.Fatal("Timed out waiting for the log file to be reopened")
+		}
+	}
+	file.Write([]byte(testMsg2 + "\n"))
+	if current, _ := os.ReadFile(logPath); string(current) != testMsg2+"\n" {
+		t.Fatalf("Expected the second record in the reopened log file, got %q", current)
+	}
+}
+
+// Ensure that missing parent directories are created up front, and that new files
+// and directories are given the configured permissions, including the sticky bit, and ownership
+func TestRotatingFilePermissions(t *testing.T) {
+	dir := t.TempDir()
+	logPath := path.Join(dir, "chtc", "jobs", "app.log")
+	file, _ := newRotatingTestFile(t, config.FileOutputConfig{
+		FilePath: logPath,
+		FileMode: "0600",
+		DirMode:  "1750",
+		Owner:    strconv.Itoa(os.Getuid()),
+		Group:    strconv.Itoa(os.Getgid()),
+		Rotation: config.FileRotationConfig{Compression: "gzip"},
+	})
+
+	for _, created := range []string{path.Join(dir, "chtc"), path.Join(dir, "chtc", "jobs")} {
+		if info, err := os.Stat(created); err != nil || info.Mode() != os.ModeDir|os.ModeSticky|0750 {
+			t.Fatalf("Expected %s to be created with mode 1750, got %v", created, info)
+		}
+	}
+	file.Write([]byte(testMsg + "\n"))
+	if err := file.Rotate(); err != nil {
+		t.Fatalf("Unable to rotate log file: %v", err)
+	}
+	file.Close()
+
+	rotated, _ := filepath.Glob(path.Join(dir, "chtc", "jobs", "app-*.log.gz"))
+	for _, created := range append(rotated, logPath) {
+		if info, err := os.Stat(created); err != nil || info.Mode() != 0600 {
+			t.Fatalf("Expected %s to be created with mode 0600, got %v", created, info)
+		}
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %v", rotated)
+	}
+}
+
+// Ensure that invalid rotation and file settings are rejected
+func TestRotatingFileInvalidConfig(t *testing.T) {
+	for _, fileCfg := range []config.FileOutputConfig{
+		{Rotation: config.FileRotationConfig{Mode: "weekly"}},
+		{Rotation: config.FileRotationConfig{Mode: "interval"}},
+		{Rotation: config.FileRotationConfig{Mode: "schedule", Schedule: "every hour"}},
+		{Rotation: config.FileRotationConfig{Compression: "lz4"}},
+		{Reopen: config.FileReopenConfig{Signal: "SIGKILL"}},
+		{Reopen: config.FileReopenConfig{Signal: "SIGHUP"}, Rotation: config.FileRotationConfig{OnSIGHUP: true}},
+		{FileMode: "rw-r--r--"},
+		{Owner: "no-such-user-chtc"},
+	} {
+		fileCfg.FilePath = path.Join(t.TempDir(), "app.log")
+		if _, err := handlers.NewRotatingFile(fileCfg); err == nil {
+			t.Errorf("Expected file settings %+v to be rejected", fileCfg)
+		}
+	}
+}
@@ -23,7 +23,9 @@ import (
 	"io"
 	"log/slog"
 	"log/syslog"
+	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/chtc/chtc-go-logger/config"
 )
@@ -34,6 +36,8 @@ type SyslogHandler struct {
 	handler slog.Handler
 	writer  *syslog.Writer
 	mu      *sync.Mutex
+	closed  *bool
+	written *atomic.Uint64
 }
 
 // Function that, given an output channel, returns an slog handler
@@ -44,8 +48,10 @@ type HandlerSupplier func(w io.Writer) slog.Handler
 // then forward the contents of that log to the syslog daemon specified by syslogOpts
 func NewSyslogHandler(syslogOpts config.SyslogOutputConfig, supplyHandler HandlerSupplier) (slog.Handler, error) {
 	handler := SyslogHandler{
-		mu:  &sync.Mutex{},
-		buf: &bytes.Buffer{},
+		mu:      &sync.Mutex{},
+		closed:  new(bool),
+		buf:     &bytes.Buffer{},
+		written: &atomic.Uint64{},
 	}
 
 	handler.handler = supplyHandler(handler.buf)
@@ -68,6 +74,9 @@ func (s *SyslogHandler) Handle(ctx context.Context, r slog.Record) (err error) {
 	// Must be thread-safe, need to write to a buffer then immediately read back
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if *s.closed {
+		return net.ErrClosed
+	}
 	// Write the log message via the child handler to the internal buffer
 	if err = s.handler.Handle(ctx, r); err != nil {
 		return err
@@ -86,15 +95,34 @@ func (s *SyslogHandler) Handle(ctx context.Context, r slog.Record) (err error) {
 	case slog.LevelError:
 		err = s.writer.Err(msg)
 	}
+	if err == nil {
+		s.written.Add(uint64(len(msg)))
+	}
 	return err
 }
 
+// BytesWritten reports the number of bytes of formatted records forwarded to syslog
+func (s *SyslogHandler) BytesWritten() uint64 {
+	return s.written.Load()
+}
+
+// Close closes the connection to the syslog daemon. Further records will fail to log
+func (s *SyslogHandler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *s.closed {
+		return nil
+	}
+	*s.closed = true
+	return s.writer.Close()
+}
+
 // Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
 func (s *SyslogHandler) WithGroup(name string) slog.Handler {
-	return &SyslogHandler{handler: s.handler.WithGroup(name), buf: s.buf, writer: s.writer, mu: s.mu}
+	return &SyslogHandler{handler: s.handler.WithGroup(name), buf: s.buf, writer: s.writer, mu: s.mu, closed: s.closed, written: s.written}
 }
 
 // Required by slog.Handler interface: Adds attributes to the writing handler
 func (s *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &SyslogHandler{handler: s.handler.WithAttrs(attrs), buf: s.buf, writer: s.writer, mu: s.mu}
+	return &SyslogHandler{handler: s.handler.WithAttrs(attrs), buf: s.buf, writer: s.writer, mu: s.mu, closed: s.closed, written: s.written}
 }
@@ -18,10 +18,15 @@
 package handlers_test
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"log/syslog"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/chtc/chtc-go-logger/config"
 	"github.com/chtc/chtc-go-logger/logger"
@@ -112,4 +117,12 @@ func TestSyslogServer(t *testing.T) {
 	logParts = <-outChan
 	verifyLogMsg(t, logParts, testMsg, syslog.LOG_ERR)
 
+	// Test that closing the logger closes the connection to syslog
+	if err := logger.Handler().(io.Closer).Close(); err != nil {
+		t.Fatalf("Failed to close syslog handler: %v", err)
+	}
+	err = logger.Handler().Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, testMsg, 0))
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Expected logging to a closed syslog handler to fail, got %v", err)
+	}
 }
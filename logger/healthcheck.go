@@ -20,187 +20,298 @@ package logger
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"log/slog"
-	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/chtc/chtc-go-logger/config"
-	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/google/uuid"
 )
 
-// HealthCheckStatus stores the last known health check timestamp and any query errors
+// HealthState summarizes whether heartbeats are reaching the health check backend
+type HealthState string
+
+const (
+	// Heartbeats are arriving within health_check.degraded_after
+	HealthHealthy HealthState = "healthy"
+	// The latest heartbeat is at least health_check.degraded_after old
+	HealthDegraded HealthState = "degraded"
+	// The latest heartbeat is at least health_check.down_after old
+	HealthDown HealthState = "down"
+)
+
+// HealthCheckStatus stores the last known health check timestamp and any query errors,
+// with the pipeline lag and state they were evaluated to
 type HealthCheckStatus struct {
+	// Time of the latest heartbeat received by the backend
 	Timestamp time.Time
-	Err       error
+	// Error from the latest query, if it failed
+	Err error
+	// How long ago the latest heartbeat was logged, as of the latest query
+	Lag time.Duration
+	// State of the pipeline, judged from Lag
+	State HealthState
 }
 
-// Atomic pointer to store the last health check status
-var lastHealthCheck atomic.Pointer[HealthCheckStatus]
-
-// Global Elasticsearch client (initialized once)
-var esClient *elasticsearch.Client
+// HealthCallback is a function type for a callback that is called whenever the
+// health check state changes. It is called on a goroutine of its own, once per change
+// and in order, so it may close the logger, such as to shut down once the pipeline is
+// down; closing the logger does not wait for it to return
+type HealthCallback func(status HealthCheckStatus)
 
-// UUID for the service instance
-var instanceUUID = uuid.New().String()
+// Runs the health check of one logger, logging heartbeats through it and
+// querying the backend for the latest heartbeat received
+type healthMonitor struct {
+	cfg      *config.Config
+	backend  HealthCheckBackend
+	callback HealthCallback
+	log      *slog.Logger
+	// Message of the heartbeat records
+	heartbeat heartbeatSettings
+	// UUID identifying this logger's heartbeats
+	instanceID string
+	// Last health check status, reported in the logger's LogStats
+	status atomic.Pointer[HealthCheckStatus]
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+	// State changes waiting to be passed to the callback, and whether a goroutine
+	// is passing them
+	callbackMu      sync.Mutex
+	pendingStatus   []HealthCheckStatus
+	callbackRunning bool
+}
 
-// StartHealthCheckMonitor starts the health check monitoring
+// StartHealthCheckMonitor starts the health check of the global logger, replacing
+// any it already has. Loggers created by New and Init start their own health check
+// when it is enabled, so this is only needed to start one with a different config
 func StartHealthCheckMonitor(ctx context.Context, cfg *config.Config) {
-	log := GetLogger()
+	startHealthCheck(ctx, GetLogger(), cfg, nil)
+}
 
-	// Initialize atomic pointer with a default value
-	lastHealthCheck.Store(&HealthCheckStatus{
-		Timestamp: time.Now().UTC(), // Current UTC timestamp
-		Err:       nil,
-	})
+// startHealthCheck starts the health check of the logger, calling callback, if set,
+// whenever the state changes. It runs until ctx is done or the logger is closed
+func startHealthCheck(ctx context.Context, log *slog.Logger, cfg *config.Config, callback HealthCallback) {
+	statHandler, ok := log.Handler().(*logDispatchStatHandler)
+	if !ok {
+		return
+	}
+	m := &healthMonitor{
+		cfg:        cfg,
+		callback:   callback,
+		log:        log,
+		heartbeat:  newHeartbeatSettings(cfg.HealthCheck),
+		instanceID: uuid.NewString(),
+	}
 
-	// Initialize Elasticsearch client
-	if err := initElasticsearchClient(cfg); err != nil {
-		log.Error("Failed to initialize Elasticsearch client",
+	// Initialize the backend the heartbeats are looked up in
+	backend, err := newHealthCheckBackend(cfg)
+	if err != nil {
+		log.Error("Failed to initialize health check backend",
 			slog.String("component", "healthcheck"),
 			slog.String("error", err.Error()),
-			slog.String("instance_uuid", instanceUUID),
+			slog.String("instance_uuid", m.instanceID),
 		)
 		return
 	}
+	m.backend = backend
 
-	log.Debug("Starting goroutines for health check monitoring",
+	// Initialize atomic pointer with a default value
+	m.status.Store(&HealthCheckStatus{
+		Timestamp: time.Now().UTC(), // Current UTC timestamp
+		Err:       nil,
+		State:     HealthHealthy,
+	})
+
+	statHandler.health.swap(m).stop()
+	m.start(ctx)
+}
+
+func (m *healthMonitor) start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	m.log.Debug("Starting goroutines for health check monitoring",
 		slog.String("component", "healthcheck"),
-		slog.String("instance_uuid", instanceUUID),
+		slog.String("instance_uuid", m.instanceID),
 	)
 
-	go logHealthChecks(ctx, cfg, log)
-	go queryElasticsearch(ctx, cfg, log)
+	m.done.Add(2)
+	go func() {
+		defer m.done.Done()
+		m.logHealthChecks(ctx)
+	}()
+	go func() {
+		defer m.done.Done()
+		m.queryBackend(ctx)
+	}()
 }
 
-// Initialize Elasticsearch client once
-func initElasticsearchClient(cfg *config.Config) error {
-	var err error
-	esClient, err = elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{cfg.HealthCheck.ElasticsearchURL},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to initialize Elasticsearch client: %w", err)
+// stop ends the health check, waiting for its goroutines to exit
+func (m *healthMonitor) stop() {
+	if m == nil {
+		return
 	}
-	return nil
+	m.cancel()
+	m.done.Wait()
 }
 
 // logHealthChecks periodically logs health check status
-func logHealthChecks(ctx context.Context, cfg *config.Config, log *slog.Logger) {
-	ticker := time.NewTicker(cfg.HealthCheck.LogPeriodicity)
+func (m *healthMonitor) logHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.HealthCheck.LogPeriodicity)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("logHealthChecks exiting",
-				slog.String("instance_uuid", instanceUUID),
+			m.log.Info("logHealthChecks exiting",
+				slog.String("instance_uuid", m.instanceID),
 			)
 			return
 		case t := <-ticker.C:
-			status := lastHealthCheck.Load()
+			status := m.status.Load()
 
-			log.Info("Health check log",
+			m.log.Info(m.heartbeat.message,
 				slog.String("component", "healthcheck"),
 				slog.Time("timestamp", t),
 				slog.Time("last_received", status.Timestamp),
-				slog.String("instance_uuid", instanceUUID),
+				slog.String("instance_uuid", m.instanceID),
 			)
 		}
 	}
 }
 
-// queryElasticsearch periodically fetches the last received health check timestamp
-func queryElasticsearch(ctx context.Context, cfg *config.Config, log *slog.Logger) {
-	ticker := time.NewTicker(cfg.HealthCheck.ElasticsearchPeriodicity)
+// queryBackend periodically fetches the last received health check timestamp
+func (m *healthMonitor) queryBackend(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.HealthCheck.ElasticsearchPeriodicity)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("queryElasticsearch exiting",
-				slog.String("instance_uuid", instanceUUID),
+			m.log.Info("queryBackend exiting",
+				slog.String("instance_uuid", m.instanceID),
 			)
 			return
 		case <-ticker.C:
-			timestamp, err := fetchLastLogTimestamp(ctx, cfg, log)
-			newStatus := &HealthCheckStatus{Timestamp: timestamp, Err: err}
+			timestamp, err := m.backend.Query(ctx, m.instanceID)
+			if ctx.Err() != nil {
+				continue
+			}
+			prevStatus := m.status.Load()
+			if err != nil {
+				// The lag keeps growing from the last heartbeat that was received
+				timestamp = prevStatus.Timestamp
+			}
+			newStatus := evaluateHealth(m.cfg.HealthCheck, timestamp, err, time.Now())
 
-			lastHealthCheck.Store(newStatus)
+			m.status.Store(newStatus)
+			if newStatus.State != prevStatus.State {
+				m.logTransition(prevStatus.State, newStatus)
+				m.notify(*newStatus)
+			}
 
 			if err != nil {
-				log.Error("Failed to fetch last log timestamp",
+				m.log.Error("Failed to fetch last log timestamp",
 					slog.String("component", "healthcheck"),
 					slog.String("error", err.Error()),
-					slog.String("instance_uuid", instanceUUID),
+					slog.String("instance_uuid", m.instanceID),
+				)
+			} else {
+				m.log.Debug("Successfully retrieved last health check timestamp",
+					slog.String("component", "healthcheck"),
+					slog.String("instance_uuid", m.instanceID),
+					slog.Time("last_timestamp", timestamp),
 				)
 			}
 		}
 	}
 }
 
-// fetchLastLogTimestamp queries Elasticsearch for the latest health check log timestamp
-func fetchLastLogTimestamp(ctx context.Context, cfg *config.Config, log *slog.Logger) (time.Time, error) {
-	query := fmt.Sprintf(`{
-		"size": 1,
-		"sort": [{ "timestamp": "desc" }],
-		"query": {
-			"bool": {
-				"must": [
-					{ "term": { "instance_uuid.keyword": "%s" }},
-					{ "term": { "msg.keyword": "Health check log" }}
-				]
-			}
-		},
-		"_source": ["timestamp"]
-	}`, instanceUUID)
-
-	res, err := esClient.Search(
-		esClient.Search.WithContext(ctx),
-		esClient.Search.WithIndex(cfg.HealthCheck.ElasticsearchIndex),
-		esClient.Search.WithBody(strings.NewReader(query)),
-		esClient.Search.WithFilterPath("hits.hits._source.timestamp"),
-	)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to execute Elasticsearch query: %w", err)
+// notify passes a state change to the callback, if any, without waiting for it
+func (m *healthMonitor) notify(status HealthCheckStatus) {
+	if m.callback == nil {
+		return
 	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		return time.Time{}, fmt.Errorf("elasticsearch query failed: %s", res.String())
+	m.callbackMu.Lock()
+	defer m.callbackMu.Unlock()
+	m.pendingStatus = append(m.pendingStatus, status)
+	if !m.callbackRunning {
+		m.callbackRunning = true
+		go m.runCallbacks()
 	}
+}
 
-	var esResp struct {
-		Hits struct {
-			Hits []struct {
-				Source struct {
-					Timestamp string `json:"timestamp"`
-				} `json:"_source"`
-			} `json:"hits"`
-		} `json:"hits"`
+// runCallbacks calls the callback with each pending state change in turn. It is not
+// part of done, so that a callback which closes the logger does not wait for itself
+func (m *healthMonitor) runCallbacks() {
+	for {
+		m.callbackMu.Lock()
+		if len(m.pendingStatus) == 0 {
+			m.callbackRunning = false
+			m.callbackMu.Unlock()
+			return
+		}
+		status := m.pendingStatus[0]
+		m.pendingStatus = m.pendingStatus[1:]
+		m.callbackMu.Unlock()
+		m.callback(status)
 	}
+}
 
-	if err := json.NewDecoder(res.Body).Decode(&esResp); err != nil {
-		return time.Time{}, fmt.Errorf("failed to decode Elasticsearch response: %w", err)
+// evaluateHealth judges the state of the pipeline from the lag of the latest heartbeat
+func evaluateHealth(healthCfg config.HealthCheckConfig, timestamp time.Time, err error, now time.Time) *HealthCheckStatus {
+	status := &HealthCheckStatus{Timestamp: timestamp, Err: err, Lag: now.Sub(timestamp), State: HealthHealthy}
+	switch {
+	case healthCfg.DownAfter > 0 && status.Lag >= healthCfg.DownAfter:
+		status.State = HealthDown
+	case healthCfg.DegradedAfter > 0 && status.Lag >= healthCfg.DegradedAfter:
+		status.State = HealthDegraded
 	}
+	return status
+}
 
-	if len(esResp.Hits.Hits) == 0 {
-		return time.Time{}, fmt.Errorf("no health check logs found")
+// logTransition logs a change of the pipeline's state, at a level reflecting the new state
+func (m *healthMonitor) logTransition(prevState HealthState, status *HealthCheckStatus) {
+	level, msg := slog.LevelInfo, "Health check recovered"
+	switch status.State {
+	case HealthDegraded:
+		level, msg = slog.LevelWarn, "Health check degraded"
+	case HealthDown:
+		level, msg = slog.LevelError, "Health check down"
 	}
-
-	parsedTime, err := time.Parse(time.RFC3339, esResp.Hits.Hits[0].Source.Timestamp)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to parse timestamp: %w", err)
+	attrs := []slog.Attr{
+		slog.String("component", "healthcheck"),
+		slog.String("previous_state", string(prevState)),
+		slog.String("state", string(status.State)),
+		slog.Duration("lag", status.Lag),
+		slog.Time("last_received", status.Timestamp),
+		slog.String("instance_uuid", m.instanceID),
+	}
+	if status.Err != nil {
+		attrs = append(attrs, slog.String("error", status.Err.Error()))
 	}
+	m.log.LogAttrs(context.Background(), level, msg, attrs...)
+}
 
-	log.Debug("Successfully retrieved last health check timestamp",
-		slog.String("component", "healthcheck"),
-		slog.String("instance_uuid", instanceUUID),
-		slog.Time("last_timestamp", parsedTime),
-	)
+// Holds the health check of a logger, shared by the handlers of its child loggers
+type healthMonitorRef struct {
+	monitor atomic.Pointer[healthMonitor]
+}
+
+// swap replaces the health check, returning the previous one
+func (r *healthMonitorRef) swap(m *healthMonitor) *healthMonitor {
+	return r.monitor.Swap(m)
+}
+
+// Status returns the last health check status, if the health check is running
+func (r *healthMonitorRef) Status() (HealthCheckStatus, bool) {
+	if m := r.monitor.Load(); m != nil {
+		return *m.status.Load(), true
+	}
+	return HealthCheckStatus{}, false
+}
 
-	return parsedTime, nil
+// stop ends the health check, if it is running
+func (r *healthMonitorRef) stop() {
+	r.swap(nil).stop()
 }
@@ -0,0 +1,575 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Default message of the heartbeat records logged by the health check
+const healthCheckMessage = "Health check log"
+
+// Settings shared by the backends for logging heartbeats and finding them again,
+// with the defaults filled in for any that are not set
+type heartbeatSettings struct {
+	// Message of the heartbeat records
+	message string
+	// Search fields holding the heartbeat's timestamp, logger instance and message
+	timestampField string
+	instanceField  string
+	messageField   string
+	// Format of the timestamp field: auto, rfc3339, epoch_millis or epoch_nanos
+	timestampFormat string
+}
+
+func newHeartbeatSettings(healthCfg config.HealthCheckConfig) heartbeatSettings {
+	orDefault := func(value, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	}
+	return heartbeatSettings{
+		message:         orDefault(healthCfg.Message, healthCheckMessage),
+		timestampField:  orDefault(healthCfg.TimestampField, "timestamp"),
+		instanceField:   orDefault(healthCfg.InstanceField, "instance_uuid.keyword"),
+		messageField:    orDefault(healthCfg.MessageField, "msg.keyword"),
+		timestampFormat: orDefault(healthCfg.TimestampFormat, "auto"),
+	}
+}
+
+// HealthCheckBackend finds the time of the latest heartbeat logged by the health check
+// of the logger instance with the given ID, as received by a log storage backend
+type HealthCheckBackend interface {
+	Query(ctx context.Context, instanceID string) (time.Time, error)
+}
+
+// HealthCheckBackendFactory creates a health check backend from the logger config
+type HealthCheckBackendFactory func(cfg *config.Config) (HealthCheckBackend, error)
+
+var (
+	healthCheckBackendsMu sync.RWMutex
+	healthCheckBackends   = map[string]HealthCheckBackendFactory{}
+)
+
+func init() {
+	RegisterHealthCheckBackend("elasticsearch", newElasticsearchBackend)
+	RegisterHealthCheckBackend("opensearch", newOpenSearchBackend)
+	RegisterHealthCheckBackend("loki", newLokiBackend)
+	RegisterHealthCheckBackend("file", newFileBackend)
+}
+
+// RegisterHealthCheckBackend makes a health check backend available to the
+// health_check.backend setting under the given name, replacing any existing
+// backend with that name
+func RegisterHealthCheckBackend(name string, factory HealthCheckBackendFactory) {
+	healthCheckBackendsMu.Lock()
+	defer healthCheckBackendsMu.Unlock()
+	healthCheckBackends[name] = factory
+}
+
+// newHealthCheckBackend creates the backend named by the config, by default Elasticsearch
+func newHealthCheckBackend(cfg *config.Config) (HealthCheckBackend, error) {
+	name := cfg.HealthCheck.Backend
+	if name == "" {
+		name = "elasticsearch"
+	}
+	healthCheckBackendsMu.RLock()
+	factory, ok := healthCheckBackends[name]
+	healthCheckBackendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown health check backend %q", name)
+	}
+	return factory(cfg)
+}
+
+// tlsTransport returns an HTTP transport using the given TLS settings
+func tlsTransport(tlsCfg config.TLSConfig) (*http.Transport, error) {
+	tlsConfig, err := tlsCfg.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// Transport that authenticates each Elasticsearch request, resolving the
+// credentials every time so that rotated secrets are picked up
+type esAuthTransport struct {
+	base      http.RoundTripper
+	healthCfg config.HealthCheckConfig
+}
+
+func (t *esAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiKey, err := t.healthCfg.ElasticsearchAPIKey.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Elasticsearch API key: %w", err)
+	}
+	password, err := t.healthCfg.ElasticsearchPassword.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Elasticsearch password: %w", err)
+	}
+	if apiKey != "" || t.healthCfg.ElasticsearchUsername != "" {
+		req = req.Clone(req.Context())
+		if apiKey != "" {
+			req.Header.Set("Authorization", "ApiKey "+apiKey)
+		} else {
+			req.SetBasicAuth(t.healthCfg.ElasticsearchUsername, password)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// query builds the Elasticsearch/OpenSearch query for the latest heartbeat
+func (h heartbeatSettings) query(instanceID string) ([]byte, error) {
+	term := func(field, value string) map[string]any {
+		return map[string]any{"term": map[string]any{field: value}}
+	}
+	return json.Marshal(map[string]any{
+		"size": 1,
+		"sort": []any{map[string]any{h.timestampField: "desc"}},
+		"query": map[string]any{
+			"bool": map[string]any{
+				"must": []any{term(h.instanceField, instanceID), term(h.messageField, h.message)},
+			},
+		},
+		"_source": []string{h.timestampField},
+	})
+}
+
+// parseSearchResponse returns the heartbeat timestamp from an Elasticsearch/OpenSearch search response
+func (h heartbeatSettings) parseSearchResponse(body io.Reader) (time.Time, error) {
+	var esResp struct {
+		Hits struct {
+			Hits []struct {
+				Source map[string]any `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&esResp); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	if len(esResp.Hits.Hits) == 0 {
+		return time.Time{}, fmt.Errorf("no health check logs found")
+	}
+
+	value, ok := sourceField(esResp.Hits.Hits[0].Source, h.timestampField)
+	if !ok {
+		return time.Time{}, fmt.Errorf("health check log has no %s field", h.timestampField)
+	}
+	parsedTime, err := h.parseTimestamp(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+	return parsedTime, nil
+}
+
+// sourceField looks up a possibly dotted field in a document's source, either as a
+// key of its own or as a path through nested objects
+func sourceField(source map[string]any, field string) (any, bool) {
+	if value, ok := source[field]; ok {
+		return value, true
+	}
+	head, rest, found := strings.Cut(field, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := source[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return sourceField(nested, rest)
+}
+
+// parseTimestamp parses a heartbeat timestamp in the configured format. In the auto
+// format, strings are RFC 3339 and numbers are epoch milliseconds, or nanoseconds if
+// they are too large to be milliseconds
+func (h heartbeatSettings) parseTimestamp(value any) (time.Time, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	default:
+		return time.Time{}, fmt.Errorf("unexpected timestamp %v", value)
+	}
+
+	format := h.timestampFormat
+	if format == "auto" {
+		format = "rfc3339"
+		if epoch, err := strconv.ParseInt(text, 10, 64); err == nil {
+			format = "epoch_millis"
+			if epoch >= 1e15 || epoch <= -1e15 {
+				format = "epoch_nanos"
+			}
+		}
+	}
+	switch format {
+	case "epoch_millis":
+		millis, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(millis).UTC(), nil
+	case "epoch_nanos":
+		nanos, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, nanos).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, text)
+}
+
+// Finds heartbeats in Elasticsearch
+type elasticsearchBackend struct {
+	client    *elasticsearch.Client
+	healthCfg config.HealthCheckConfig
+	heartbeat heartbeatSettings
+}
+
+func newElasticsearchBackend(cfg *config.Config) (HealthCheckBackend, error) {
+	healthCfg := cfg.HealthCheck
+	transport, err := tlsTransport(healthCfg.ElasticsearchTLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Elasticsearch connection: %w", err)
+	}
+
+	esCfg := elasticsearch.Config{
+		CloudID:   healthCfg.ElasticsearchCloudID,
+		Transport: &esAuthTransport{base: transport, healthCfg: healthCfg},
+	}
+	if esCfg.CloudID == "" {
+		esCfg.Addresses = healthCheckAddresses(healthCfg)
+	}
+	client, err := elasticsearch.NewClient(esCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Elasticsearch client: %w", err)
+	}
+	return &elasticsearchBackend{client: client, healthCfg: healthCfg, heartbeat: newHeartbeatSettings(healthCfg)}, nil
+}
+
+// healthCheckAddresses lists the Elasticsearch/OpenSearch node URLs to query
+func healthCheckAddresses(healthCfg config.HealthCheckConfig) []string {
+	var addresses []string
+	if healthCfg.ElasticsearchURL != "" {
+		addresses = append(addresses, healthCfg.ElasticsearchURL)
+	}
+	return append(addresses, healthCfg.ElasticsearchAddresses...)
+}
+
+func (b *elasticsearchBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	if timeout := b.healthCfg.ElasticsearchRequestTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	query, err := b.heartbeat.query(instanceID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to build Elasticsearch query: %w", err)
+	}
+	res, err := b.client.Search(
+		b.client.Search.WithContext(ctx),
+		b.client.Search.WithIndex(b.healthCfg.ElasticsearchIndex),
+		b.client.Search.WithBody(bytes.NewReader(query)),
+		b.client.Search.WithFilterPath("hits.hits._source"),
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to execute Elasticsearch query: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return time.Time{}, fmt.Errorf("elasticsearch query failed: %s", res.String())
+	}
+	return b.heartbeat.parseSearchResponse(res.Body)
+}
+
+// Finds heartbeats in OpenSearch, which shares the Elasticsearch search API and
+// connection settings but is rejected by the Elasticsearch client
+type openSearchBackend struct {
+	client    *http.Client
+	addresses []string
+	healthCfg config.HealthCheckConfig
+	heartbeat heartbeatSettings
+}
+
+func newOpenSearchBackend(cfg *config.Config) (HealthCheckBackend, error) {
+	healthCfg := cfg.HealthCheck
+	transport, err := tlsTransport(healthCfg.ElasticsearchTLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure OpenSearch connection: %w", err)
+	}
+	return &openSearchBackend{
+		client:    &http.Client{Transport: &esAuthTransport{base: transport, healthCfg: healthCfg}},
+		addresses: healthCheckAddresses(healthCfg),
+		healthCfg: healthCfg,
+		heartbeat: newHeartbeatSettings(healthCfg),
+	}, nil
+}
+
+// Query tries each address in turn until one answers
+func (b *openSearchBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	if timeout := b.healthCfg.ElasticsearchRequestTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	query, err := b.heartbeat.query(instanceID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to build OpenSearch query: %w", err)
+	}
+	err = errors.New("no OpenSearch addresses configured")
+	for _, address := range b.addresses {
+		searchURL := strings.TrimSuffix(address, "/") + "/" + url.PathEscape(b.healthCfg.ElasticsearchIndex) +
+			"/_search?filter_path=hits.hits._source"
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, searchURL, bytes.NewReader(query))
+		if reqErr != nil {
+			return time.Time{}, reqErr
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		res, reqErr := b.client.Do(req)
+		if reqErr != nil {
+			err = fmt.Errorf("failed to execute OpenSearch query: %w", reqErr)
+			continue
+		}
+		timestamp, resErr := func() (time.Time, error) {
+			defer res.Body.Close()
+			if res.StatusCode >= 300 {
+				body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+				return time.Time{}, fmt.Errorf("opensearch query failed: %s: %s", res.Status, bytes.TrimSpace(body))
+			}
+			return b.heartbeat.parseSearchResponse(res.Body)
+		}()
+		if res.StatusCode >= 500 {
+			// Try the next node
+			err = resErr
+			continue
+		}
+		return timestamp, resErr
+	}
+	return time.Time{}, err
+}
+
+// Finds heartbeats in Grafana Loki
+type lokiBackend struct {
+	client    *http.Client
+	lokiCfg   config.LokiHealthCheckConfig
+	heartbeat heartbeatSettings
+}
+
+func newLokiBackend(cfg *config.Config) (HealthCheckBackend, error) {
+	lokiCfg := cfg.HealthCheck.Loki
+	transport, err := tlsTransport(lokiCfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Loki connection: %w", err)
+	}
+	if lokiCfg.Lookback <= 0 {
+		lokiCfg.Lookback = time.Hour
+	}
+	return &lokiBackend{
+		client:    &http.Client{Transport: transport, Timeout: lokiCfg.RequestTimeout},
+		lokiCfg:   lokiCfg,
+		heartbeat: newHeartbeatSettings(cfg.HealthCheck),
+	}, nil
+}
+
+func (b *lokiBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	now := time.Now()
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("%s |= %s | json | %s=%s | %s=%s", b.lokiCfg.Selector, strconv.Quote(instanceID),
+		lokiJSONLabel(recordField(b.heartbeat.messageField)), strconv.Quote(b.heartbeat.message),
+		lokiJSONLabel(recordField(b.heartbeat.instanceField)), strconv.Quote(instanceID)))
+	params.Set("start", strconv.FormatInt(now.Add(-b.lokiCfg.Lookback).UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(now.UnixNano(), 10))
+	params.Set("direction", "backward")
+	params.Set("limit", "1")
+
+	queryURL := strings.TrimSuffix(b.lokiCfg.URL, "/") + "/loki/api/v1/query_range?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if b.lokiCfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", b.lokiCfg.TenantID)
+	}
+	if b.lokiCfg.Username != "" {
+		password, err := b.lokiCfg.Password.Resolve()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to resolve Loki password: %w", err)
+		}
+		req.SetBasicAuth(b.lokiCfg.Username, password)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to execute Loki query: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return time.Time{}, fmt.Errorf("loki query failed: %s: %s", res.Status, bytes.TrimSpace(body))
+	}
+
+	var lokiResp struct {
+		Data struct {
+			Result []struct {
+				Values [][2]string `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&lokiResp); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode Loki response: %w", err)
+	}
+	var latest time.Time
+	for _, stream := range lokiResp.Data.Result {
+		for _, value := range stream.Values {
+			timestamp, err := b.heartbeat.lineTimestamp([]byte(value[1]), instanceID)
+			if err != nil {
+				// Fall back to the time Loki recorded for the entry
+				nanos, parseErr := strconv.ParseInt(value[0], 10, 64)
+				if parseErr != nil {
+					return time.Time{}, fmt.Errorf("failed to parse timestamp: %w", parseErr)
+				}
+				timestamp = time.Unix(0, nanos).UTC()
+			}
+			if timestamp.After(latest) {
+				latest = timestamp
+			}
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, fmt.Errorf("no health check logs found")
+	}
+	return latest, nil
+}
+
+// lineTimestamp returns the timestamp of a JSON record if it is a heartbeat from the
+// given logger instance, finding its fields as configured for searches
+func (h heartbeatSettings) lineTimestamp(line []byte, instanceID string) (time.Time, error) {
+	var record map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return time.Time{}, err
+	}
+	msg, _ := sourceField(record, recordField(h.messageField))
+	instance, _ := sourceField(record, recordField(h.instanceField))
+	if msg != h.message || instance != instanceID {
+		return time.Time{}, errors.New("not a heartbeat from this logger")
+	}
+	value, ok := sourceField(record, recordField(h.timestampField))
+	if !ok {
+		return time.Time{}, fmt.Errorf("health check log has no %s field", h.timestampField)
+	}
+	return h.parseTimestamp(value)
+}
+
+// recordField returns the field of a record that a search field is indexed from,
+// dropping the .keyword suffix of Elasticsearch keyword subfields
+func recordField(field string) string {
+	return strings.TrimSuffix(field, ".keyword")
+}
+
+// lokiJSONLabel returns the label that Loki's json parser extracts a possibly
+// nested field to, joining nested names with underscores and replacing any
+// characters that are not allowed in label names
+func lokiJSONLabel(field string) string {
+	label := []byte(field)
+	for i, c := range label {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			label[i] = '_'
+		}
+	}
+	return string(label)
+}
+
+// Finds heartbeats at the end of a JSON log file, such as that of the file output
+type fileBackend struct {
+	path      string
+	tailBytes int64
+	heartbeat heartbeatSettings
+}
+
+func newFileBackend(cfg *config.Config) (HealthCheckBackend, error) {
+	fileCfg := cfg.HealthCheck.File
+	if fileCfg.Path == "" {
+		fileCfg.Path = cfg.FileOutput.FilePath
+	}
+	if fileCfg.Path == "" {
+		return nil, errors.New("no log file to search for health check logs")
+	}
+	if fileCfg.TailBytes <= 0 {
+		fileCfg.TailBytes = 1 << 20
+	}
+	return &fileBackend{path: fileCfg.Path, tailBytes: fileCfg.TailBytes, heartbeat: newHeartbeatSettings(cfg.HealthCheck)}, nil
+}
+
+// Query searches the end of the file, from the last record backwards
+func (b *fileBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	offset := max(info.Size()-b.tailBytes, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && !errors.Is(err, io.EOF) {
+		return time.Time{}, fmt.Errorf("failed to read log file: %w", err)
+	}
+
+	lines := bytes.Split(tail, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !bytes.Contains(lines[i], []byte(instanceID)) {
+			continue
+		}
+		if timestamp, err := b.heartbeat.lineTimestamp(lines[i], instanceID); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no health check logs found")
+}
@@ -0,0 +1,575 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	stdlog "log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// ID of the logger instance whose heartbeats the fake backends answer with
+const testInstanceID = "5b0a7f52-3c1e-4d7a-9a51-0c2f4e6d8b19"
+
+// Ensure that Elasticsearch requests are authenticated with the current value of
+// each secret, so that rotated credentials are picked up
+func TestElasticsearchAuthRotation(t *testing.T) {
+	var username, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ = r.BasicAuth()
+	}))
+	defer server.Close()
+
+	passwordFile := path.Join(t.TempDir(), "es-password")
+	client := &http.Client{Transport: &esAuthTransport{
+		base: http.DefaultTransport,
+		healthCfg: config.HealthCheckConfig{
+			ElasticsearchUsername: "elastic",
+			ElasticsearchPassword: config.Secret("file://" + passwordFile),
+		},
+	}}
+	for _, secret := range []string{"hunter2", "hunter3"} {
+		if err := os.WriteFile(passwordFile, []byte(secret+"\n"), 0600); err != nil {
+			t.Fatalf("failed to write password file: %v", err)
+		}
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+		if username != "elastic" || password != secret {
+			t.Errorf("expected credentials elastic:%s, got %s:%s", secret, username, password)
+		}
+	}
+}
+
+// Starts a TLS server answering health check queries like Elasticsearch, if the
+// request's Authorization header is as expected
+func newFakeElasticsearch(t *testing.T, authorization string, delay time.Duration) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"hits":{"hits":[{"_source":{"timestamp":"2025-03-01T12:00:00Z"}}]}}`)
+	}))
+	// Rejected handshakes are expected
+	server.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Ensure that the health check can query Elasticsearch over TLS with a private CA
+// or without verification, authenticating with basic auth or an API key, and
+// falling back to further addresses
+func TestHealthCheckElasticsearchTLS(t *testing.T) {
+	basicAuth := newFakeElasticsearch(t, "Basic ZWxhc3RpYzpodW50ZXIy", 0)
+	apiKey := newFakeElasticsearch(t, "ApiKey a2V5", 0)
+	slow := newFakeElasticsearch(t, "", 500*time.Millisecond)
+
+	caFile := path.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: basicAuth.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+	t.Setenv("CHTC_TEST_ES_CA", string(caPEM))
+
+	for name, test := range map[string]struct {
+		healthCfg config.HealthCheckConfig
+		errMsg    string
+	}{
+		"private CA and basic auth": {healthCfg: config.HealthCheckConfig{
+			ElasticsearchURL:       "https://127.0.0.1:1",
+			ElasticsearchAddresses: []string{basicAuth.URL},
+			ElasticsearchUsername:  "elastic",
+			ElasticsearchPassword:  "hunter2",
+			ElasticsearchTLS:       config.TLSConfig{Enabled: true, CAFile: caFile},
+		}},
+		"CA secret and API key": {healthCfg: config.HealthCheckConfig{
+			ElasticsearchURL:    apiKey.URL,
+			ElasticsearchAPIKey: "a2V5",
+			ElasticsearchTLS:    config.TLSConfig{Enabled: true, CAFile: "env:CHTC_TEST_ES_CA"},
+		}},
+		"unverified": {healthCfg: config.HealthCheckConfig{
+			ElasticsearchURL: apiKey.URL,
+		}, errMsg: "certificate"},
+		"insecure skip verify": {healthCfg: config.HealthCheckConfig{
+			ElasticsearchURL:    apiKey.URL,
+			ElasticsearchAPIKey: "a2V5",
+			ElasticsearchTLS:    config.TLSConfig{Enabled: true, InsecureSkipVerify: true},
+		}},
+		"request timeout": {healthCfg: config.HealthCheckConfig{
+			ElasticsearchURL:            slow.URL,
+			ElasticsearchTLS:            config.TLSConfig{Enabled: true, InsecureSkipVerify: true},
+			ElasticsearchRequestTimeout: 50 * time.Millisecond,
+		}, errMsg: "deadline exceeded"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{HealthCheck: test.healthCfg}
+			backend, err := newElasticsearchBackend(cfg)
+			if err != nil {
+				t.Fatalf("failed to create Elasticsearch backend: %v", err)
+			}
+			timestamp, err := backend.Query(context.Background(), testInstanceID)
+			if test.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+					t.Fatalf("expected an error containing %q, got %v", test.errMsg, err)
+				}
+			} else if err != nil || !timestamp.Equal(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)) {
+				t.Fatalf("expected the health check timestamp, got %v (%v)", timestamp, err)
+			}
+		})
+	}
+}
+
+// Ensure that the Elasticsearch nodes loaded from the config are only those configured,
+// and that one of the URL, addresses or cloud ID is required
+func TestHealthCheckConfiguredAddresses(t *testing.T) {
+	t.Setenv("LOGGER__HEALTH_CHECK__ENABLED", "true")
+	t.Setenv("LOGGER__HEALTH_CHECK__ELASTICSEARCH_ADDRESSES", "https://es1:9200,https://es2:9200")
+	cfg, err := config.LoadConfig("", nil)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if addresses := healthCheckAddresses(cfg.HealthCheck); !reflect.DeepEqual(addresses, []string{"https://es1:9200", "https://es2:9200"}) {
+		t.Fatalf("expected only the configured addresses, got %v", addresses)
+	}
+
+	t.Setenv("LOGGER__HEALTH_CHECK__ELASTICSEARCH_ADDRESSES", "")
+	if _, err := config.LoadConfig("", nil); err == nil || !strings.Contains(err.Error(), "health_check.elasticsearch_url: must be set") {
+		t.Fatalf("expected an error for the missing Elasticsearch URL, got %v", err)
+	}
+}
+
+// Ensure that OpenSearch is queried with the Elasticsearch settings, falling back to
+// further nodes, and that Loki is queried for this instance's latest heartbeat
+func TestHealthCheckSearchBackends(t *testing.T) {
+	expected := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	openSearch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/healthcheck_logs/_search" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"hits":{"hits":[{"_source":{"timestamp":"2025-03-01T12:00:00Z"}}]}}`)
+	}))
+	defer openSearch.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	var query url.Values
+	var tenant string
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, tenant = r.URL.Query(), r.Header.Get("X-Scope-OrgID")
+		line := fmt.Sprintf(`{"msg":%q,"instance_uuid":%q,"timestamp":"2025-03-01T12:00:00Z"}`, healthCheckMessage, testInstanceID)
+		json.NewEncoder(w).Encode(map[string]any{"status": "success", "data": map[string]any{
+			"resultType": "streams",
+			"result":     []any{map[string]any{"stream": map[string]string{"job": "chtc"}, "values": [][2]string{{"1740830400000000000", line}}}},
+		}})
+	}))
+	defer loki.Close()
+
+	for name, healthCfg := range map[string]config.HealthCheckConfig{
+		"opensearch": {
+			Backend:                "opensearch",
+			ElasticsearchIndex:     "healthcheck_logs",
+			ElasticsearchURL:       unavailable.URL,
+			ElasticsearchAddresses: []string{openSearch.URL},
+		},
+		"loki": {
+			Backend: "loki",
+			Loki:    config.LokiHealthCheckConfig{URL: loki.URL, Selector: `{job="chtc"}`, TenantID: "chtc"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend, err := newHealthCheckBackend(&config.Config{HealthCheck: healthCfg})
+			if err != nil {
+				t.Fatalf("failed to create backend: %v", err)
+			}
+			timestamp, err := backend.Query(context.Background(), testInstanceID)
+			if err != nil || !timestamp.Equal(expected) {
+				t.Fatalf("expected the health check timestamp, got %v (%v)", timestamp, err)
+			}
+		})
+	}
+	if logQL := query.Get("query"); !strings.HasPrefix(logQL, `{job="chtc"}`) || !strings.Contains(logQL, "| json | msg=") ||
+		!strings.Contains(logQL, "| instance_uuid="+strconv.Quote(testInstanceID)) ||
+		query.Get("direction") != "backward" || query.Get("limit") != "1" || tenant != "chtc" {
+		t.Errorf("unexpected Loki query %v for tenant %q", query, tenant)
+	}
+}
+
+// Ensure that the file backend finds this instance's latest heartbeat in the log file,
+// ignoring other records and heartbeats from other instances
+func TestHealthCheckFileBackend(t *testing.T) {
+	logFile := path.Join(t.TempDir(), "app.log")
+	file, err := os.Create(logFile)
+	if err != nil {
+		t.Fatalf("failed to create log file: %v", err)
+	}
+	log := slog.New(slog.NewJSONHandler(file, nil))
+	log.Info(healthCheckMessage, "timestamp", time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC), "instance_uuid", testInstanceID)
+	log.Info(healthCheckMessage, "timestamp", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), "instance_uuid", testInstanceID)
+	log.Info(healthCheckMessage, "timestamp", time.Date(2025, 3, 1, 13, 0, 0, 0, time.UTC), "instance_uuid", "other")
+	log.Info("Unrelated", "instance_uuid", testInstanceID)
+	file.Close()
+
+	cfg := &config.Config{
+		FileOutput:  config.FileOutputConfig{FilePath: logFile},
+		HealthCheck: config.HealthCheckConfig{Backend: "file"},
+	}
+	backend, err := newHealthCheckBackend(cfg)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	timestamp, err := backend.Query(context.Background(), testInstanceID)
+	if err != nil || !timestamp.Equal(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the latest heartbeat of this instance, got %v (%v)", timestamp, err)
+	}
+}
+
+// Ensure that the file backend finds heartbeats by the configured fields and timestamp format
+func TestHealthCheckFileBackendFields(t *testing.T) {
+	logFile := path.Join(t.TempDir(), "app.log")
+	line := fmt.Sprintf(`{"message":%q,"labels":{"instance":%q},"event":{"created":1740830400000}}`, healthCheckMessage, testInstanceID)
+	if err := os.WriteFile(logFile, []byte(line+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+
+	cfg := &config.Config{
+		FileOutput: config.FileOutputConfig{FilePath: logFile},
+		HealthCheck: config.HealthCheckConfig{
+			Backend:         "file",
+			MessageField:    "message.keyword",
+			InstanceField:   "labels.instance",
+			TimestampField:  "event.created",
+			TimestampFormat: "epoch_millis",
+		},
+	}
+	backend, err := newHealthCheckBackend(cfg)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	timestamp, err := backend.Query(context.Background(), testInstanceID)
+	if err != nil || !timestamp.Equal(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the heartbeat with the configured fields, got %v (%v)", timestamp, err)
+	}
+}
+
+type staticBackend time.Time
+
+func (b staticBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	return time.Time(b), nil
+}
+
+// Ensure that backends can be registered and chosen by name
+func TestRegisterHealthCheckBackend(t *testing.T) {
+	expected := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	RegisterHealthCheckBackend("static", func(cfg *config.Config) (HealthCheckBackend, error) {
+		return staticBackend(expected), nil
+	})
+	backend, err := newHealthCheckBackend(&config.Config{HealthCheck: config.HealthCheckConfig{Backend: "static"}})
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	if timestamp, _ := backend.Query(context.Background(), testInstanceID); !timestamp.Equal(expected) {
+		t.Errorf("expected the registered backend to be used, got %v", timestamp)
+	}
+	if _, err := newHealthCheckBackend(&config.Config{HealthCheck: config.HealthCheckConfig{Backend: "missing"}}); err == nil {
+		t.Errorf("expected an unknown backend to be rejected")
+	}
+}
+
+// Ensure that the pipeline lag is judged against the thresholds
+func TestEvaluateHealth(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	healthCfg := config.HealthCheckConfig{DegradedAfter: time.Minute, DownAfter: 5 * time.Minute}
+	for lag, expected := range map[time.Duration]HealthState{
+		10 * time.Second: HealthHealthy,
+		time.Minute:      HealthDegraded,
+		time.Hour:        HealthDown,
+	} {
+		status := evaluateHealth(healthCfg, now.Add(-lag), nil, now)
+		if status.Lag != lag || status.State != expected {
+			t.Errorf("expected a lag of %v to be %s, got %v and %s", lag, expected, status.Lag, status.State)
+		}
+	}
+	if status := evaluateHealth(config.HealthCheckConfig{}, now.Add(-time.Hour), nil, now); status.State != HealthHealthy {
+		t.Errorf("expected no thresholds to leave the pipeline healthy, got %s", status.State)
+	}
+}
+
+// Backend whose latest heartbeat is set by the test
+type settableBackend struct{ lag atomic.Int64 }
+
+func (b *settableBackend) Query(ctx context.Context, instanceID string) (time.Time, error) {
+	return time.Now().Add(-time.Duration(b.lag.Load())), nil
+}
+
+// Writer that may be written by the health check goroutines while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Ensure that each logger runs its own health check, whose state changes are logged,
+// reported to the health callback and exposed only in that logger's LogStats, and
+// which stops when the logger is closed
+func TestHealthCheckTransitions(t *testing.T) {
+	backend := &settableBackend{}
+	backend.lag.Store(int64(time.Hour))
+	RegisterHealthCheckBackend("settable", func(cfg *config.Config) (HealthCheckBackend, error) {
+		return backend, nil
+	})
+
+	var captured syncBuffer
+	transitions := make(chan HealthCheckStatus, 10)
+	log, err := New(
+		WithConsole(false),
+		WithFileOutput(false),
+		WithOutput("capture", slog.NewJSONHandler(&captured, nil)),
+		WithOverride(func(cfg *config.Config) {
+			cfg.HealthCheck = config.HealthCheckConfig{
+				Enabled:                  true,
+				Backend:                  "settable",
+				LogPeriodicity:           time.Hour,
+				ElasticsearchPeriodicity: 10 * time.Millisecond,
+				DegradedAfter:            time.Minute,
+				DownAfter:                5 * time.Minute,
+			}
+		}),
+		WithHealthCallback(func(status HealthCheckStatus) { transitions <- status }),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	other, err := New(WithConsole(false), WithFileOutput(false), WithOutput("discard", slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+
+	expectTransition := func(expected HealthState) {
+		t.Helper()
+		select {
+		case status := <-transitions:
+			if status.State != expected {
+				t.Fatalf("expected the state to become %s, got %s (lag %v)", expected, status.State, status.Lag)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the state to become %s", expected)
+		}
+	}
+	expectTransition(HealthDown)
+	log.WithGroup("request").Info("checking stats")
+	if stats := log.Handler().(LogStatHandler).GetLatestStats(); stats.HealthCheck.State != HealthDown || stats.HealthCheck.Lag < time.Hour {
+		t.Errorf("expected LogStats to report the pipeline down, got %+v", stats.HealthCheck)
+	}
+	other.Info("checking stats")
+	if stats := other.Handler().(LogStatHandler).GetLatestStats(); stats.HealthCheck.State != "" {
+		t.Errorf("expected a logger without a health check not to report one, got %+v", stats.HealthCheck)
+	}
+
+	backend.lag.Store(0)
+	expectTransition(HealthHealthy)
+	log.Handler().(io.Closer).Close()
+	output := captured.String()
+	if !strings.Contains(output, `"level":"ERROR","msg":"Health check down"`) || !strings.Contains(output, `"level":"INFO","msg":"Health check recovered"`) {
+		t.Errorf("expected the transitions to be logged, got %s", output)
+	}
+	if !strings.Contains(output, "queryBackend exiting") {
+		t.Errorf("expected the health check to stop when the logger is closed, got %s", output)
+	}
+}
+
+// Ensure that the health callback may close the logger whose health check called it
+func TestHealthCallbackClosesLogger(t *testing.T) {
+	backend := &settableBackend{}
+	backend.lag.Store(int64(time.Hour))
+	RegisterHealthCheckBackend("settable", func(cfg *config.Config) (HealthCheckBackend, error) {
+		return backend, nil
+	})
+
+	closed := make(chan error, 1)
+	var log *slog.Logger
+	var ready sync.WaitGroup
+	ready.Add(1)
+	log, err := New(
+		WithConsole(false),
+		WithFileOutput(false),
+		WithOutput("discard", slog.NewTextHandler(io.Discard, nil)),
+		WithOverride(func(cfg *config.Config) {
+			cfg.HealthCheck = config.HealthCheckConfig{
+				Enabled:                  true,
+				Backend:                  "settable",
+				LogPeriodicity:           time.Hour,
+				ElasticsearchPeriodicity: 10 * time.Millisecond,
+				DownAfter:                time.Minute,
+			}
+		}),
+		WithHealthCallback(func(status HealthCheckStatus) {
+			ready.Wait()
+			if status.State == HealthDown {
+				closed <- log.Handler().(io.Closer).Close()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	ready.Done()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("unexpected error closing logger: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the health callback to be able to close the logger")
+	}
+	if _, running := log.Handler().(*logDispatchStatHandler).health.Status(); running {
+		t.Error("expected the health check to be stopped")
+	}
+}
+
+// Ensure that initializing the global logger again stops the health check of the one it replaces
+func TestInitReplacesHealthCheck(t *testing.T) {
+	RegisterHealthCheckBackend("settable", func(cfg *config.Config) (HealthCheckBackend, error) {
+		return &settableBackend{}, nil
+	})
+	opts := []Option{
+		WithConsole(false),
+		WithFileOutput(false),
+		WithOutput("discard", slog.NewTextHandler(io.Discard, nil)),
+		WithOverride(func(cfg *config.Config) {
+			cfg.HealthCheck = config.HealthCheckConfig{
+				Enabled:                  true,
+				Backend:                  "settable",
+				LogPeriodicity:           time.Hour,
+				ElasticsearchPeriodicity: time.Hour,
+			}
+		}),
+	}
+	if err := Init(opts...); err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	first := GetLogger().Handler().(*logDispatchStatHandler)
+	if err := Init(opts...); err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	second := GetLogger().Handler().(*logDispatchStatHandler)
+	defer second.Close()
+
+	if _, running := first.health.Status(); running {
+		t.Errorf("expected the replaced logger's health check to be stopped")
+	}
+	if _, running := second.health.Status(); !running {
+		t.Errorf("expected the new logger's health check to be running")
+	}
+}
+
+// Ensure that search queries are JSON-encoded with the configured fields and message,
+// and that heartbeat timestamps are parsed in each supported format
+func TestHeartbeatQueryAndTimestamps(t *testing.T) {
+	heartbeat := newHeartbeatSettings(config.HealthCheckConfig{
+		Message:        `Pipeline "heartbeat"`,
+		TimestampField: "event.created",
+		InstanceField:  "labels.instance",
+	})
+	query, err := heartbeat.query(testInstanceID)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	var decoded struct {
+		Sort  []map[string]string `json:"sort"`
+		Query struct {
+			Bool struct {
+				Must []map[string]map[string]string `json:"must"`
+			} `json:"bool"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal(query, &decoded); err != nil {
+		t.Fatalf("expected a valid JSON query, got %s: %v", query, err)
+	}
+	must := decoded.Query.Bool.Must
+	if len(decoded.Sort) != 1 || decoded.Sort[0]["event.created"] != "desc" || len(must) != 2 ||
+		must[0]["term"]["labels.instance"] != testInstanceID || must[1]["term"]["msg.keyword"] != `Pipeline "heartbeat"` {
+		t.Errorf("unexpected query %s", query)
+	}
+	if label := lokiJSONLabel(recordField("labels.instance.keyword")); label != "labels_instance" {
+		t.Errorf("expected the Loki label of a nested field to be labels_instance, got %s", label)
+	}
+
+	expected := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for format, sources := range map[string][]string{
+		"auto": {
+			`{"event.created":"2025-03-01T12:00:00Z"}`,
+			`{"event":{"created":1740830400000}}`,
+			`{"event.created":"1740830400000000000"}`,
+		},
+		"epoch_millis": {`{"event.created":"1740830400000"}`},
+		"epoch_nanos":  {`{"event":{"created":1740830400000000000}}`},
+		"rfc3339":      {`{"event.created":"2025-03-01T06:00:00-06:00"}`},
+	} {
+		heartbeat.timestampFormat = format
+		for _, source := range sources {
+			body := fmt.Sprintf(`{"hits":{"hits":[{"_source":%s}]}}`, source)
+			if timestamp, err := heartbeat.parseSearchResponse(strings.NewReader(body)); err != nil || !timestamp.Equal(expected) {
+				t.Errorf("expected %s in the %s format to be %v, got %v (%v)", source, format, expected, timestamp, err)
+			}
+		}
+	}
+	heartbeat.timestampFormat = "rfc3339"
+	if _, err := heartbeat.parseSearchResponse(strings.NewReader(`{"hits":{"hits":[{"_source":{"event.created":1740830400000}}]}}`)); err == nil {
+		t.Errorf("expected an epoch timestamp to be rejected in the rfc3339 format")
+	}
+}
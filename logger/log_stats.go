@@ -20,8 +20,10 @@ package logger
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"path"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -48,13 +50,78 @@ type LogStats struct {
 	// The time that the log message took to produce
 	Duration time.Duration
 	// If file-based output is available, the remaining storage space
-	// on the file output's storage device
+	// on the file outputs' storage devices (the least, if there are several)
 	DiskAvail uint64
 	// An array of errors that occured in each of the logger's
 	// sub-handlers
 	Errors []LogError
 	// The most recent remote health-check result for this logger
 	HealthCheck HealthCheckStatus
+	// Delivery statistics for each sub-handler that sends records in batches,
+	// keyed by the sub-handler's label
+	Batches map[string]handlers.BatchStats
+	// Health of each sub-handler, keyed by the sub-handler's label
+	Outputs map[string]OutputHealth
+}
+
+// OutputHealth reports how well one of the logger's sub-handlers is handling records
+type OutputHealth struct {
+	// The last time the sub-handler handled a record without error. For sub-handlers
+	// that send records in batches, the last time a batch was delivered
+	LastSuccess time.Time
+	// Number of records in a row the sub-handler has failed to handle
+	ConsecutiveErrors int
+	// For sub-handlers that send records in batches, the number of batches in a row
+	// of which no record could be delivered
+	ConsecutiveFailedBatches int
+	// The most recent error from the sub-handler, if any
+	LastError error
+	// The time of the most recent error
+	LastErrorTime time.Time
+	// Number of records handled without error
+	Records uint64
+	// Number of bytes of formatted records written, for sub-handlers that report it
+	Bytes uint64
+}
+
+// Tracks the health of a sub-handler, shared by the handlers of child loggers
+type outputHealthTracker struct {
+	mu     sync.Mutex
+	health OutputHealth
+}
+
+func (t *outputHealthTracker) record(err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.health.ConsecutiveErrors++
+		t.health.LastError = err
+		t.health.LastErrorTime = now
+		return
+	}
+	t.health.ConsecutiveErrors = 0
+	t.health.LastSuccess = now
+	t.health.Records++
+}
+
+func (t *outputHealthTracker) snapshot(handler slog.Handler) OutputHealth {
+	t.mu.Lock()
+	health := t.health
+	t.mu.Unlock()
+	if reporter, ok := handler.(handlers.BytesWrittenReporter); ok {
+		health.Bytes = reporter.BytesWritten()
+	}
+	if reporter, ok := handler.(handlers.BatchStatsReporter); ok {
+		// Handling a record only queues it, so judge the sub-handler by its deliveries
+		batches := reporter.BatchStats()
+		health.LastSuccess = batches.LastDelivered
+		health.ConsecutiveFailedBatches = batches.ConsecutiveFailedBatches
+		if batches.LastDeliveryErrorTime.After(health.LastErrorTime) {
+			health.LastError = batches.LastDeliveryError
+			health.LastErrorTime = batches.LastDeliveryErrorTime
+		}
+	}
+	return health
 }
 
 // LogStatsCallback is a function type for a callback that accepts a LogStats
@@ -70,34 +137,112 @@ type LogStatHandler interface {
 	SetStatsCallbackHandler(LogStatsCallback)
 }
 
+// Interface for LogStatHandlers that report the health of the logger. The handlers of
+// this package's loggers implement it, and io.Closer to flush and release any
+// resources (connections, queued records) held by their sub-handlers
+type HealthReporter interface {
+	// Return an error if any sub-handler has failed to handle the latest
+	// health_check.max_consecutive_errors records, or to deliver that many batches
+	// in a row, or if the health check finds the logging pipeline down
+	Healthy() error
+}
+
 // Handler that wraps another set of slog handlers, and implements LogStatHandler
 type logDispatchStatHandler struct {
-	handlers      []handlers.NamedHandler
-	logConfig     config.Config
-	latestStats   LogStats
-	statsCallback LogStatsCallback
+	handlers  []handlers.NamedHandler
+	logConfig config.Config
+	// Set from the goroutines logging through the handler, such as the health check's
+	latestStats   atomic.Pointer[LogStats]
+	statsCallback atomic.Pointer[LogStatsCallback]
 	sequence      *atomic.Uint64
 	logId         string
+	logPaths      []string
+	// Route rules for the sub-handlers, keyed by label
+	routes map[string]*outputRoute
+	// Dotted path of the logger's group, and attributes added to the logger within it
+	group       string
+	loggerAttrs map[string]string
+	// If set, the labels of the only sub-handlers records are sent to
+	pinned map[string]bool
+	// Health check of the logger, if it is enabled
+	health *healthMonitorRef
+	// Health of each sub-handler, keyed by label
+	outputHealth map[string]*outputHealthTracker
+	// Registry the logger's metrics are recorded in, and the admin listener serving them, if any
+	metrics *Metrics
+	admin   *adminServer
 }
 
 func (s *logDispatchStatHandler) GetLatestStats() LogStats {
-	return s.latestStats
+	if stats := s.latestStats.Load(); stats != nil {
+		return *stats
+	}
+	return LogStats{}
 }
 
 func (s *logDispatchStatHandler) SetStatsCallbackHandler(callback LogStatsCallback) {
-	s.statsCallback = callback
+	s.statsCallback.Store(&callback)
+}
+
+func (s *logDispatchStatHandler) Close() error {
+	// Stop the health check first, since it logs through the sub-handlers
+	s.health.stop()
+
+	return errors.Join(s.admin.Close(), closeHandlers(s.handlers))
+}
+
+// outputHealthStats returns the health of every sub-handler, keyed by label
+func (s *logDispatchStatHandler) outputHealthStats() map[string]OutputHealth {
+	outputs := make(map[string]OutputHealth, len(s.handlers))
+	for _, handler := range s.handlers {
+		if tracker := s.outputHealth[handler.HandlerType]; tracker != nil {
+			outputs[handler.HandlerType] = tracker.snapshot(handler.Handler)
+		}
+	}
+	return outputs
+}
+
+func (s *logDispatchStatHandler) Healthy() error {
+	var errs []error
+	maxErrors := s.logConfig.HealthCheck.MaxConsecutiveErrors
+	outputs := s.outputHealthStats()
+	for _, handler := range s.handlers {
+		health := outputs[handler.HandlerType]
+		if maxErrors > 0 && health.ConsecutiveErrors >= maxErrors {
+			errs = append(errs, fmt.Errorf("output %s failed to handle the last %d records: %w", handler.HandlerType, health.ConsecutiveErrors, health.LastError))
+		} else if maxErrors > 0 && health.ConsecutiveFailedBatches >= maxErrors {
+			errs = append(errs, fmt.Errorf("output %s failed to deliver the last %d batches: %w", handler.HandlerType, health.ConsecutiveFailedBatches, health.LastError))
+		}
+	}
+	if status, ok := s.health.Status(); ok && status.State == HealthDown {
+		errs = append(errs, fmt.Errorf("health check is down: the latest heartbeat was received %s ago", status.Lag.Round(time.Second)))
+	}
+	return errors.Join(errs...)
 }
 
 // NewLogStatsHandler constructs a new metrics-collecting log handler
 // LogStatsHandler wraps the handler given in the constructor, collecting
 // info such as log message duration and disk usage with each log message
 func NewLogStatsHandler(logConfig config.Config, handlers []handlers.NamedHandler) LogStatHandler {
+	return newLogStatsHandler(logConfig, handlers, nil)
+}
+
+// newLogStatsHandler constructs a LogStatsHandler that sends records to each
+// sub-handler only if they are allowed by its route, if any
+func newLogStatsHandler(logConfig config.Config, handlers []handlers.NamedHandler, routes map[string]*outputRoute) *logDispatchStatHandler {
 	var seq atomic.Uint64
 	handler := logDispatchStatHandler{
 		handlers:  handlers,
 		logConfig: logConfig,
 		logId:     uuid.NewString(),
 		sequence:  &seq,
+		logPaths:  fileOutputPaths(logConfig),
+		routes:    routes,
+		health:    &healthMonitorRef{},
+	}
+	handler.outputHealth = make(map[string]*outputHealthTracker, len(handlers))
+	for _, h := range handlers {
+		handler.outputHealth[h.HandlerType] = &outputHealthTracker{}
 	}
 
 	return &handler
@@ -113,8 +258,8 @@ func (s *logDispatchStatHandler) Enabled(ctx context.Context, level slog.Level)
 	return false
 }
 
-func (s *logDispatchStatHandler) statLogFS() (uint64, error) {
-	fs := path.Dir(s.logConfig.FileOutput.FilePath)
+func statLogFS(logPath string) (uint64, error) {
+	fs := path.Dir(logPath)
 
 	stat := unix.Statfs_t{}
 
@@ -141,8 +286,19 @@ func (s *logDispatchStatHandler) Handle(ctx context.Context, r slog.Record) erro
 	}
 	// Call into the actual log handler, checking for errors on result
 	errs := make([]LogError, 0, len(s.handlers))
+	routed := routedRecord{record: r, group: s.group, loggerAttrs: s.loggerAttrs}
+	var sent []string
 	for _, handler := range s.handlers {
+		if !handler.Enabled(ctx, r.Level) || !s.routesTo(handler.HandlerType, &routed) {
+			continue
+		}
+		if s.metrics != nil {
+			sent = append(sent, handler.HandlerType)
+		}
 		err := handler.Handle(ctx, r)
+		if tracker := s.outputHealth[handler.HandlerType]; tracker != nil {
+			tracker.record(err, time.Now())
+		}
 		if err != nil {
 			errs = append(errs, LogError{
 				Err:     err,
@@ -152,16 +308,32 @@ func (s *logDispatchStatHandler) Handle(ctx context.Context, r slog.Record) erro
 		}
 	}
 
+	// Collect delivery statistics from batching sub-handlers
+	for _, handler := range s.handlers {
+		if reporter, ok := handler.Handler.(handlers.BatchStatsReporter); ok {
+			if stats.Batches == nil {
+				stats.Batches = make(map[string]handlers.BatchStats)
+			}
+			stats.Batches[handler.HandlerType] = reporter.BatchStats()
+		}
+	}
+
+	// Report the health of every sub-handler
+	stats.Outputs = s.outputHealthStats()
+
 	// If filesystem logging is enabled, check usage
 	// This is probably a pretty big performance bottleneck
-	if s.logConfig.FileOutput.Enabled {
-		usage, err := s.statLogFS()
-		stats.DiskAvail = usage
+	for _, logPath := range s.logPaths {
+		usage, err := statLogFS(logPath)
 		if err != nil {
 			errs = append(errs, LogError{
 				Err:    err,
 				Record: r,
 			})
+			continue
+		}
+		if stats.DiskAvail == 0 || usage < stats.DiskAvail {
+			stats.DiskAvail = usage
 		}
 	}
 
@@ -170,14 +342,17 @@ func (s *logDispatchStatHandler) Handle(ctx context.Context, r slog.Record) erro
 
 	stats.Duration = elapsed
 	stats.Errors = errs
-	if heathCheck := lastHealthCheck.Load(); heathCheck != nil {
-		stats.HealthCheck = *heathCheck
+	if healthCheck, ok := s.health.Status(); ok {
+		stats.HealthCheck = healthCheck
 	}
 
-	s.latestStats = stats
+	s.latestStats.Store(&stats)
+	if s.metrics != nil {
+		s.metrics.record(r.Level, sent, stats, len(s.logPaths) > 0)
+	}
 
-	if s.statsCallback != nil {
-		s.statsCallback(stats)
+	if callback := s.statsCallback.Load(); callback != nil && *callback != nil {
+		(*callback)(stats)
 	}
 
 	if len(errs) == 0 {
@@ -201,14 +376,13 @@ func (s *logDispatchStatHandler) WithGroup(name string) slog.Handler {
 			HandlerType: handler.HandlerType,
 		}
 	}
-	return &logDispatchStatHandler{
-		handlers:      newHandlers,
-		statsCallback: s.statsCallback,
-		logConfig:     s.logConfig,
-		// New logger shares same outputs with parent, so sequence # can be kept persistent
-		logId:    s.logId,
-		sequence: s.sequence,
+	child := s.child(newHandlers)
+	if child.group == "" {
+		child.group = name
+	} else {
+		child.group += "." + name
 	}
+	return child
 }
 
 // Required by slog.Handler interface: Adds attributes to the writing handler
@@ -220,12 +394,55 @@ func (s *logDispatchStatHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 			HandlerType: handler.HandlerType,
 		}
 	}
-	return &logDispatchStatHandler{
-		handlers:      newHandlers,
-		statsCallback: s.statsCallback,
-		logConfig:     s.logConfig,
+	child := s.child(newHandlers)
+	child.loggerAttrs = make(map[string]string, len(s.loggerAttrs)+len(attrs))
+	for key, value := range s.loggerAttrs {
+		child.loggerAttrs[key] = value
+	}
+	for _, attr := range attrs {
+		flattenAttr(s.group, attr, child.loggerAttrs)
+	}
+	return child
+}
+
+// withRoute returns a child handler that sends records only to the sub-handlers with the given labels
+func (s *logDispatchStatHandler) withRoute(outputs []string) *logDispatchStatHandler {
+	child := s.child(s.handlers)
+	child.pinned = make(map[string]bool, len(outputs))
+	for _, output := range outputs {
+		child.pinned[output] = true
+	}
+	return child
+}
+
+// child returns a handler for a child logger, writing to the given sub-handlers
+func (s *logDispatchStatHandler) child(newHandlers []handlers.NamedHandler) *logDispatchStatHandler {
+	child := &logDispatchStatHandler{
+		handlers:  newHandlers,
+		logConfig: s.logConfig,
 		// New logger shares same outputs with parent, so sequence # can be kept persistent
-		logId:    s.logId,
-		sequence: s.sequence,
+		logId:       s.logId,
+		sequence:    s.sequence,
+		logPaths:    s.logPaths,
+		routes:      s.routes,
+		group:       s.group,
+		loggerAttrs: s.loggerAttrs,
+		pinned:      s.pinned,
+		health:      s.health,
+		// Children write to the same outputs, so share their health
+		outputHealth: s.outputHealth,
+		metrics:      s.metrics,
+		admin:        s.admin,
+	}
+	child.statsCallback.Store(s.statsCallback.Load())
+	return child
+}
+
+// routesTo reports whether a record should be sent to the sub-handler with the given label
+func (s *logDispatchStatHandler) routesTo(label string, rec *routedRecord) bool {
+	if s.pinned != nil {
+		return s.pinned[label]
 	}
+	route := s.routes[label]
+	return route == nil || route.allows(rec)
 }
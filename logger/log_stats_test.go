@@ -21,11 +21,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -280,7 +285,8 @@ func TestLogStatsContainHealthCheck(t *testing.T) {
 			Enabled:  true,
 		},
 		HealthCheck: config.HealthCheckConfig{
-			Enabled: true,
+			Enabled:          true,
+			ElasticsearchURL: "http://127.0.0.1:1",
 		},
 	}
 	log, err := NewContextAwareLogger(cfg)
@@ -289,8 +295,14 @@ func TestLogStatsContainHealthCheck(t *testing.T) {
 		t.Fatalf("Unable to create logger: %v", err)
 	}
 
+	defer log.Close()
+
+	// The health check also logs, from its own goroutines
+	var mu sync.Mutex
 	var lastStats LogStats
 	log.SetErrorCallback(func(stats LogStats) {
+		mu.Lock()
+		defer mu.Unlock()
 		lastStats = stats
 	})
 
@@ -299,9 +311,15 @@ func TestLogStatsContainHealthCheck(t *testing.T) {
 		Timestamp: time.Now(),
 		Err:       errors.New("Sample Health Check Error"),
 	}
-	lastHealthCheck.Store(&sampleHealthCheck)
+	monitor := log.statHandler.(*logDispatchStatHandler).health.monitor.Load()
+	if monitor == nil {
+		t.Fatalf("Expected the logger to have started a health check")
+	}
+	monitor.status.Store(&sampleHealthCheck)
 
 	log.Info(context.Background(), "Test msg")
+	mu.Lock()
+	defer mu.Unlock()
 
 	if len(lastStats.Errors) != 0 {
 		t.Fatalf("Expected 0 errors to occur during logging, got %v", len(lastStats.Errors))
@@ -417,3 +435,133 @@ func TestLogSequencing(t *testing.T) {
 	}
 
 }
+
+// Handler that fails while its failing flag is set
+type flakyHandler struct {
+	slog.Handler
+	failing *atomic.Bool
+}
+
+func (h flakyHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.failing.Load() {
+		return errors.New("output unavailable")
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// Ensure that LogStats reports the health of every output, shared by child loggers,
+// and that the logger is unhealthy only while an output keeps failing
+func TestLogStatsOutputHealth(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "app.log")
+	var failing atomic.Bool
+	log, err := New(
+		WithConfig(&config.Config{FileOutput: config.FileOutputConfig{FilePath: logPath}}),
+		WithConsole(false),
+		WithSequenceInfo(false),
+		WithOutput("flaky", flakyHandler{Handler: slog.NewTextHandler(io.Discard, nil), failing: &failing}),
+		WithOverride(func(cfg *config.Config) { cfg.HealthCheck.MaxConsecutiveErrors = 2 }),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create logger: %v", err)
+	}
+	statHandler := log.Handler().(*logDispatchStatHandler)
+	defer statHandler.Close()
+
+	log.Info("first")
+	log.With("request", 1).Info("second")
+	failing.Store(true)
+	log.Info("third")
+	if err := statHandler.Healthy(); err != nil {
+		t.Fatalf("Expected a single error to leave the logger healthy, got %v", err)
+	}
+	log.Info("fourth")
+
+	stats := statHandler.GetLatestStats()
+	file, flaky := stats.Outputs[HandlerFile], stats.Outputs["flaky"]
+	content, _ := os.ReadFile(logPath)
+	if file.Records != 4 || file.Bytes != uint64(len(content)) || file.ConsecutiveErrors != 0 || file.LastSuccess.IsZero() {
+		t.Errorf("Expected the file output to have written 4 records (%d bytes), got %+v", len(content), file)
+	}
+	if flaky.Records != 2 || flaky.ConsecutiveErrors != 2 || flaky.LastError == nil || flaky.LastErrorTime.Before(flaky.LastSuccess) {
+		t.Errorf("Expected the flaky output to have failed twice in a row, got %+v", flaky)
+	}
+	if err := statHandler.Healthy(); err == nil || !strings.Contains(err.Error(), "output flaky failed to handle the last 2 records") {
+		t.Errorf("Expected the failing output to make the logger unhealthy, got %v", err)
+	}
+
+	failing.Store(false)
+	log.Info("fifth")
+	if err := statHandler.Healthy(); err != nil {
+		t.Errorf("Expected the logger to be healthy once the output recovers, got %v", err)
+	}
+}
+
+// Ensure that an output which accepts records but cannot deliver them makes the
+// logger unhealthy, and that the output recovers once its batches are delivered
+func TestLogStatsBatchDeliveryHealth(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, `{"errors":false,"items":[]}`)
+	}))
+	defer srv.Close()
+
+	log, err := New(
+		WithConsole(false),
+		WithSequenceInfo(false),
+		WithOverride(func(cfg *config.Config) {
+			cfg.FileOutput.Enabled = false
+			cfg.HealthCheck.MaxConsecutiveErrors = 2
+			cfg.ElasticsearchOutput = config.ElasticsearchOutputConfig{
+				Label:     "elasticsearch",
+				Enabled:   true,
+				Addresses: []string{srv.URL},
+				Index:     "logs",
+				Batch:     config.BatchConfig{MaxBatchSize: 1, FlushInterval: 10 * time.Millisecond, QueueSize: 10},
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create logger: %v", err)
+	}
+	statHandler := log.Handler().(*logDispatchStatHandler)
+	defer statHandler.Close()
+
+	waitForHealth := func(healthy bool) error {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			err := statHandler.Healthy()
+			if (err == nil) == healthy || time.Now().After(deadline) {
+				return err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	log.Info("first")
+	log.Info("second")
+	if err := waitForHealth(false); err == nil || !strings.Contains(err.Error(), "output elasticsearch failed to deliver the last 2 batches") {
+		t.Fatalf("Expected undeliverable batches to make the logger unhealthy, got %v", err)
+	}
+	health := statHandler.outputHealthStats()["elasticsearch"]
+	if health.ConsecutiveFailedBatches < 2 || health.LastError == nil || !health.LastSuccess.IsZero() {
+		t.Errorf("Expected the output to report its failed deliveries, got %+v", health)
+	}
+
+	failing.Store(false)
+	log.Info("third")
+	if err := waitForHealth(true); err != nil {
+		t.Errorf("Expected the logger to be healthy once a batch is delivered, got %v", err)
+	}
+	health = statHandler.outputHealthStats()["elasticsearch"]
+	if health.ConsecutiveFailedBatches != 0 || health.LastSuccess.IsZero() {
+		t.Errorf("Expected the output to report its delivery, got %+v", health)
+	}
+}
@@ -32,7 +32,6 @@ import (
 
 	"github.com/chtc/chtc-go-logger/config"
 	handler "github.com/chtc/chtc-go-logger/logger/handlers"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -49,34 +48,86 @@ type contextKey string
 const LogAttrsKey contextKey = "logAttrs"
 
 // LogInit initializes the global logger.
-// Accepts optional parameters: string (configFile) and *config.Config/config.Config (overrides).
+// Accepts optional parameters: string (configFile), *config.Config/config.Config (overrides),
+// handlers.NamedHandler/[]handlers.NamedHandler (additional outputs),
+// config.LoadOption (such as config.Strict()), and Option (such as WithConsole(false)).
+// Returns a *config.ValidationError if the configuration is invalid.
+// Prefer Init, which checks the types of its options at compile time.
 func LogInit(params ...interface{}) error {
-	var err error
+	opts, err := paramOptions(params...)
+	if err != nil {
+		return err
+	}
+	return Init(opts...)
+}
 
+// Init initializes the global logger from the given options, starting the
+// health check if it is enabled. The health check runs until the context given
+// with WithContext is cancelled, or until the process receives SIGINT or SIGTERM.
+// If the global logger was already initialized, the health check and admin listener
+// of the logger it replaces are stopped, but its outputs are left open, since loggers
+// obtained from GetLogger or derived from it may still be in use. Close it through
+// its handler's io.Closer once they are done with it. If the new logger cannot be
+// started, the old one is left in place. An admin listener on the same address is
+// handed over to the new logger rather than restarted.
+// Returns a *config.ValidationError if the configuration is invalid.
+func Init(opts ...Option) error {
 	// Ensure global context and cancel are initialized once
 	setupOnce.Do(func() {
 		globalCtx, globalCancel = context.WithCancel(context.Background())
 		setupShutdownHandler() // Setup signal handling for clean shutdown
 	})
 
-	// Parse the parameters
-	cfg, err := parseParams(params...)
+	o := newOptions(opts)
+	cfg, err := o.loadConfig()
 	if err != nil {
 		return err
 	}
 
 	// Create the logger
-	log, err = createLogger(cfg)
+	newLog, err := createLogger(cfg, o.handlers...)
 	if err != nil {
 		return err
 	}
+	// The logger being replaced keeps running until the new one is ready, so that it
+	// is still fully functional if the new one cannot be started
+	var oldHandler *logDispatchStatHandler
+	if log != nil {
+		oldHandler, _ = log.Handler().(*logDispatchStatHandler)
+	}
+	var oldAdmin *adminServer
+	if oldHandler != nil {
+		oldAdmin = oldHandler.admin
+	}
+	if err := startMetrics(newLog, cfg.Metrics, o.metrics, oldAdmin); err != nil {
+		newLog.Handler().(*logDispatchStatHandler).Close()
+		return err
+	}
+	// Stop the health check and admin listener of the logger being replaced, so only
+	// one runs, unless the new logger has taken the listener over. Its outputs are
+	// left to the caller to close
+	if oldHandler != nil {
+		oldHandler.health.stop()
+		if oldHandler.admin == newLog.Handler().(*logDispatchStatHandler).admin {
+			oldHandler.admin = nil
+		} else {
+			oldHandler.admin.Close()
+		}
+	}
+	log = newLog
 
 	// Start Health Check if enabled
 	if cfg.HealthCheck.Enabled {
-		StartHealthCheckMonitor(globalCtx, cfg)
+		ctx := globalCtx
+		if o.ctx != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(o.ctx)
+			context.AfterFunc(globalCtx, cancel)
+		}
+		startHealthCheck(ctx, newLog, cfg, o.healthCallback)
 	}
 
-	return err
+	return nil
 }
 
 func setupShutdownHandler() {
@@ -96,103 +147,250 @@ func setupShutdownHandler() {
 }
 
 // NewLogger creates and returns a new logger.
-// Accepts optional parameters: string (configFile) and *config.Config/config.Config (overrides).
+// Accepts optional parameters: string (configFile), *config.Config/config.Config (overrides),
+// handlers.NamedHandler/[]handlers.NamedHandler (additional outputs),
+// config.LoadOption (such as config.Strict()), and Option (such as WithConsole(false)).
+// Returns a *config.ValidationError if the configuration is invalid.
+// Prefer New, which checks the types of its options at compile time.
 func NewLogger(params ...interface{}) (*slog.Logger, error) {
-	// Parse the parameters
-	cfg, err := parseParams(params...)
+	opts, err := paramOptions(params...)
 	if err != nil {
 		return nil, err
 	}
-
-	// Create and return a new logger
-	return createLogger(cfg)
+	return New(opts...)
 }
 
-// parseParams parses the variadic parameters and loads the configuration.
-func parseParams(params ...interface{}) (*config.Config, error) {
-	var configFile string
-	var overrides *config.Config
+// New creates and returns a new logger from the given options, with its own health
+// check if it is enabled. If a context is given with WithContext, the health check
+// is stopped and the logger's outputs are flushed and closed once it is done;
+// otherwise they run until the logger's handler is closed through io.Closer.
+// Returns a *config.ValidationError if the configuration is invalid.
+func New(opts ...Option) (*slog.Logger, error) {
+	o := newOptions(opts)
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	newLog, err := createLogger(cfg, o.handlers...)
+	if err != nil {
+		return nil, err
+	}
+	if err := startMetrics(newLog, cfg.Metrics, o.metrics, nil); err != nil {
+		newLog.Handler().(*logDispatchStatHandler).Close()
+		return nil, err
+	}
+	if cfg.HealthCheck.Enabled {
+		ctx := o.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		startHealthCheck(ctx, newLog, cfg, o.healthCallback)
+	}
+	if o.ctx != nil {
+		statHandler := newLog.Handler().(*logDispatchStatHandler)
+		context.AfterFunc(o.ctx, func() { statHandler.Close() })
+	}
+	return newLog, nil
+}
 
-	// Process the parameters
+// paramOptions converts the untyped parameters of LogInit and NewLogger to Options
+func paramOptions(params ...interface{}) ([]Option, error) {
+	var opts []Option
 	for _, param := range params {
 		switch v := param.(type) {
+		case nil:
+			// Allows LogInit("", nil) to request the defaults
 		case string:
-			configFile = v
+			opts = append(opts, WithConfigFile(v))
 		case *config.Config:
-			overrides = v
+			opts = append(opts, WithConfig(v))
 		case config.Config:
-			overrides = &v
+			opts = append(opts, WithConfig(&v))
+		case handler.NamedHandler:
+			opts = append(opts, withHandlers(v))
+		case []handler.NamedHandler:
+			opts = append(opts, withHandlers(v...))
+		case config.LoadOption:
+			opts = append(opts, WithLoadOptions(v))
+		case Option:
+			opts = append(opts, v)
 		default:
 			return nil, errors.New("invalid parameter type")
 		}
 	}
-
-	// Load the configuration
-	return config.LoadConfig(configFile, overrides)
+	return opts, nil
 }
 
-// createLogger creates a logger using the provided configuration.
-func createLogger(cfg *config.Config) (*slog.Logger, error) {
+// createLogger creates a logger using the provided configuration, sending records
+// to the configured outputs and to any extra handlers passed in.
+// If an output can't be created, the outputs already created are closed.
+func createLogger(cfg *config.Config, extraHandlers ...handler.NamedHandler) (_ *slog.Logger, err error) {
 	var handlers []handler.NamedHandler
+	routeCfgs := map[string]config.RouteConfig{}
+	// Number of handlers created here rather than passed in, which are closed on failure,
+	// once the extra handlers have been added
+	created := -1
+	defer func() {
+		if err != nil {
+			if created < 0 {
+				created = len(handlers)
+			}
+			closeHandlers(handlers[:created])
+		}
+	}()
+
+	// Minimum level of the outputs, from log_level
+	opts, err := levelOptions(cfg.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log_level: %w", err)
+	}
 
 	// Console handler
 	if cfg.ConsoleOutput.Enabled {
-		handler := handler.NamedHandler{HandlerType: cfg.ConsoleOutput.Label}
-		if cfg.ConsoleOutput.JSONOutput {
-			handler.Handler = slog.NewJSONHandler(os.Stdout, nil)
-		} else if cfg.ConsoleOutput.Colors {
-			handler.Handler = &ColorConsoleHandler{output: os.Stdout}
-		} else {
-			handler.Handler = slog.NewTextHandler(os.Stdout, nil)
-		}
-		handlers = append(handlers, handler)
+		handlers = append(handlers, handler.NamedHandler{Handler: newConsoleOutput(cfg.ConsoleOutput, opts), HandlerType: cfg.ConsoleOutput.Label})
+		routeCfgs[cfg.ConsoleOutput.Label] = cfg.ConsoleOutput.Route
 	}
 
 	// File handler
 	if cfg.FileOutput.Enabled {
-		if cfg.FileOutput.FilePath == "" {
-			panic("File output enabled but file path is empty")
+		fileHandler, err := newFileOutput(cfg.FileOutput, opts)
+		if err != nil {
+			return nil, err
 		}
-		handlers = append(handlers, handler.NamedHandler{
-			Handler: slog.NewJSONHandler(&lumberjack.Logger{
-				Filename:   cfg.FileOutput.FilePath,
-				MaxSize:    cfg.FileOutput.MaxFileSize,
-				MaxBackups: cfg.FileOutput.MaxBackups,
-				MaxAge:     cfg.FileOutput.MaxAgeDays,
-				Compress:   true,
-			}, nil),
-			HandlerType: cfg.FileOutput.Label,
-		})
+
+		handlers = append(handlers, handler.NamedHandler{Handler: fileHandler, HandlerType: cfg.FileOutput.Label})
+		routeCfgs[cfg.FileOutput.Label] = cfg.FileOutput.Route
 	}
 
 	// Syslog handler
 	if cfg.SyslogOutput.Enabled {
-		var (
-			syslogHandler slog.Handler
-			err           error
-		)
-		if cfg.SyslogOutput.JSONOutput {
-			syslogHandler, err = handler.NewSyslogHandler(cfg.SyslogOutput, func(w io.Writer) slog.Handler {
-				return slog.NewJSONHandler(w, nil)
-			})
-		} else {
-			syslogHandler, err = handler.NewSyslogHandler(cfg.SyslogOutput, func(w io.Writer) slog.Handler {
-				return slog.NewTextHandler(w, nil)
-			})
-		}
+		syslogHandler, err := newSyslogOutput(cfg.SyslogOutput, opts)
 		if err != nil {
 			return nil, err
 		}
 
 		handlers = append(handlers, handler.NamedHandler{Handler: syslogHandler, HandlerType: cfg.SyslogOutput.Label})
+		routeCfgs[cfg.SyslogOutput.Label] = cfg.SyslogOutput.Route
+	}
+
+	// Journald handler
+	if cfg.JournaldOutput.Enabled {
+		journaldHandler, err := newJournaldOutput(cfg.JournaldOutput, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: journaldHandler, HandlerType: cfg.JournaldOutput.Label})
+		routeCfgs[cfg.JournaldOutput.Label] = cfg.JournaldOutput.Route
+	}
+
+	// Network handler
+	if cfg.NetworkOutput.Enabled {
+		networkHandler, err := handler.NewNetworkHandler(cfg.NetworkOutput, jsonSupplier(opts))
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: networkHandler, HandlerType: cfg.NetworkOutput.Label})
+		routeCfgs[cfg.NetworkOutput.Label] = cfg.NetworkOutput.Route
+	}
+
+	// Fluentd forward handler
+	if cfg.FluentdOutput.Enabled {
+		fluentdHandler, err := handler.NewFluentdHandler(cfg.FluentdOutput, jsonSupplier(opts))
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: fluentdHandler, HandlerType: cfg.FluentdOutput.Label})
+		routeCfgs[cfg.FluentdOutput.Label] = cfg.FluentdOutput.Route
+	}
+
+	// Elasticsearch bulk handler
+	if cfg.ElasticsearchOutput.Enabled {
+		esHandler, err := handler.NewElasticsearchHandler(cfg.ElasticsearchOutput, jsonSupplier(opts))
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: esHandler, HandlerType: cfg.ElasticsearchOutput.Label})
+		routeCfgs[cfg.ElasticsearchOutput.Label] = cfg.ElasticsearchOutput.Route
+	}
+
+	if cfg.OTLPOutput.Enabled {
+		otlpHandler, err := handler.NewOTLPHandler(cfg.OTLPOutput, cfg.Service, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: otlpHandler, HandlerType: cfg.OTLPOutput.Label})
+		routeCfgs[cfg.OTLPOutput.Label] = cfg.OTLPOutput.Route
+	}
+
+	if cfg.HTTPOutput.Enabled {
+		httpHandler, err := handler.NewHTTPHandler(cfg.HTTPOutput, jsonSupplier(opts))
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: httpHandler, HandlerType: cfg.HTTPOutput.Label})
+		routeCfgs[cfg.HTTPOutput.Label] = cfg.HTTPOutput.Route
+	}
+
+	if cfg.QueueOutput.Enabled {
+		queueHandler, err := newQueueOutput(cfg.QueueOutput, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		handlers = append(handlers, handler.NamedHandler{Handler: queueHandler, HandlerType: cfg.QueueOutput.Label})
+		routeCfgs[cfg.QueueOutput.Label] = cfg.QueueOutput.Route
+	}
+
+	// Outputs registered with RegisterOutput
+	registeredHandlers, err := createOutputs(cfg, routeCfgs)
+	if err != nil {
+		return nil, err
+	}
+	handlers = append(handlers, registeredHandlers...)
+	created = len(handlers)
+	handlers = append(handlers, extraHandlers...)
+
+	// Labels identify the handler that errors came from, so must not be shared
+	labels := make(map[string]bool, len(handlers))
+	for _, h := range handlers {
+		if labels[h.HandlerType] {
+			return nil, fmt.Errorf("more than one output is labeled %q; give each output a distinct label", h.HandlerType)
+		}
+		labels[h.HandlerType] = true
 	}
 
 	// Fallback to a basic console logger if no handlers are configured
 	if len(handlers) == 0 {
-		handlers = append(handlers, handler.NamedHandler{Handler: slog.NewTextHandler(os.Stdout, nil), HandlerType: cfg.ConsoleOutput.Label})
+		handlers = append(handlers, handler.NamedHandler{Handler: slog.NewTextHandler(os.Stdout, opts), HandlerType: cfg.ConsoleOutput.Label})
+	}
+
+	routes, err := compileRoutes(routeCfgs)
+	if err != nil {
+		return nil, err
 	}
 
-	return slog.New(NewLogStatsHandler(*cfg, handlers)), nil
+	return slog.New(newLogStatsHandler(*cfg, handlers, routes)), nil
+}
+
+// closeHandlers flushes and closes every handler that holds resources, such as
+// connections and queued records
+func closeHandlers(namedHandlers []handler.NamedHandler) error {
+	var errs []error
+	for _, h := range namedHandlers {
+		if closer, ok := h.Handler.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close %s: %w", h.HandlerType, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // GetLogger returns the global logger. If `LogInit` is not called, it initializes the logger with default settings.
@@ -206,6 +404,21 @@ func GetLogger() *slog.Logger {
 	return log
 }
 
+// Healthy returns an error if the global logger is not initialized, if any of its
+// outputs has failed to handle the latest health_check.max_consecutive_errors records
+// or to deliver that many batches in a row, or if its health check finds the logging
+// pipeline down. Suitable for Kubernetes liveness and readiness probes
+func Healthy() error {
+	if log == nil {
+		return errors.New("logger is not initialized")
+	}
+	reporter, ok := log.Handler().(HealthReporter)
+	if !ok {
+		return errors.New("logger does not report its health")
+	}
+	return reporter.Healthy()
+}
+
 // --- Context-Aware Logger ---
 
 // ContextAwareLogger wraps slog.Logger to support context-based logging
@@ -239,6 +452,24 @@ func (l *ContextAwareLogger) SetErrorCallback(callback LogStatsCallback) {
 	l.statHandler.SetStatsCallbackHandler(callback)
 }
 
+// Healthy returns an error if the logger's outputs are failing or its health check
+// finds the logging pipeline down
+func (l *ContextAwareLogger) Healthy() error {
+	reporter, ok := l.statHandler.(HealthReporter)
+	if !ok {
+		return errors.New("logger does not report its health")
+	}
+	return reporter.Healthy()
+}
+
+// Close flushes any queued log records and releases the logger's outputs
+func (l *ContextAwareLogger) Close() error {
+	if closer, ok := l.statHandler.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // Log logs a message at the specified level with context attributes and additional attributes
 func (l *ContextAwareLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
 	// Extract attributes from context
@@ -297,11 +528,12 @@ func extractContextAttributes(ctx context.Context) []slog.Attr {
 // ColorConsoleHandler provides color-coded console logging
 type ColorConsoleHandler struct {
 	output io.Writer
+	level  slog.Leveler // Minimum level to output, if any
 }
 
 // Required by slog.Handler interface: Determines if this handler processes a log record at the given level
 func (h *ColorConsoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return true
+	return h.level == nil || level >= h.level.Level()
 }
 
 // Required by slog.Handler interface: Processes and outputs a log record
@@ -18,10 +18,14 @@
 package logger
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"log/slog"
 	"os"
+	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/chtc/chtc-go-logger/config"
@@ -80,6 +84,35 @@ func TestContextAwareLogger(t *testing.T) {
 	}
 }
 
+// Ensure that initializing the global logger again leaves the logger it replaces
+// open for loggers still using it, until the caller closes it
+func TestInitKeepsReplacedLogger(t *testing.T) {
+	var first, second atomic.Bool
+	var output bytes.Buffer
+	dir := t.TempDir()
+	var replaced *slog.Logger
+	for _, closed := range []*atomic.Bool{&first, &second} {
+		err := Init(
+			WithConfig(&config.Config{FileOutput: config.FileOutputConfig{FilePath: path.Join(dir, "app.log")}}),
+			WithOutput("closer", closingHandler{slog.NewJSONHandler(&output, nil), closed}),
+		)
+		if err != nil {
+			t.Fatalf("failed to initialize logger: %v", err)
+		}
+		if replaced == nil {
+			replaced = GetLogger()
+		}
+	}
+	replaced.Info("still logging")
+	if first.Load() || second.Load() || !strings.Contains(output.String(), "still logging") {
+		t.Fatalf("expected the replaced logger to be left open, got closed %v and output %q", first.Load(), output.String())
+	}
+	replaced.Handler().(io.Closer).Close()
+	if !first.Load() || second.Load() {
+		t.Fatalf("expected only the replaced logger to be closed, got %v and %v", first.Load(), second.Load())
+	}
+}
+
 // Helper function to check if a string is contained
 func contains(content, substring string) bool {
 	return len(content) >= len(substring) && strings.Contains(content, substring)
@@ -0,0 +1,287 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Upper bounds of the buckets of the Handle duration histogram, in seconds
+var handleDurationBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics is a registry of Prometheus metrics recorded from the LogStats of the
+// loggers it is passed to with WithMetrics. It is an http.Handler serving the
+// metrics in the Prometheus text format, for applications to mount alongside their own
+type Metrics struct {
+	mu sync.Mutex
+	// Records sent to each output, by level and output label
+	records map[[2]string]uint64
+	// Errors from each output, by output label
+	errors map[string]uint64
+	// Handle duration histogram: count per bucket, then the total count and sum
+	durationBuckets []uint64
+	durationCount   uint64
+	durationSum     float64
+	// Gauges, which are only exposed once they have been set
+	diskAvail      *float64
+	healthCheckLag *float64
+	queueDepth     map[string]float64
+}
+
+// NewMetrics constructs an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		records:         map[[2]string]uint64{},
+		errors:          map[string]uint64{},
+		durationBuckets: make([]uint64, len(handleDurationBuckets)),
+		queueDepth:      map[string]float64{},
+	}
+}
+
+// record updates the metrics from the LogStats of a record at the given level,
+// which was sent to the outputs with the given labels
+func (m *Metrics) record(level slog.Level, outputs []string, stats LogStats, diskChecked bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, output := range outputs {
+		m.records[[2]string{level.String(), output}]++
+	}
+	for _, logErr := range stats.Errors {
+		if logErr.Handler.Handler != nil {
+			m.errors[logErr.Handler.HandlerType]++
+		}
+	}
+
+	seconds := stats.Duration.Seconds()
+	for i, bound := range handleDurationBuckets {
+		if seconds <= bound {
+			m.durationBuckets[i]++
+		}
+	}
+	m.durationCount++
+	m.durationSum += seconds
+
+	if diskChecked {
+		diskAvail := float64(stats.DiskAvail)
+		m.diskAvail = &diskAvail
+	}
+	if stats.HealthCheck.State != "" {
+		lag := stats.HealthCheck.Lag.Seconds()
+		m.healthCheckLag = &lag
+	}
+	for output, batches := range stats.Batches {
+		m.queueDepth[output] = float64(batches.Queued)
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := &countingBufWriter{w: bufio.NewWriter(w)}
+	family := func(name, kind, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	family("chtc_logger_records_total", "counter", "Records sent to each output, by level.")
+	for _, key := range sortedKeys(m.records, func(a, b [2]string) bool { return a[1] < b[1] || a[1] == b[1] && a[0] < b[0] }) {
+		fmt.Fprintf(out, "chtc_logger_records_total{level=%s,output=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.records[key])
+	}
+
+	family("chtc_logger_output_errors_total", "counter", "Errors from each output.")
+	for _, output := range sortedKeys(m.errors, func(a, b string) bool { return a < b }) {
+		fmt.Fprintf(out, "chtc_logger_output_errors_total{output=%s} %d\n", quoteLabel(output), m.errors[output])
+	}
+
+	family("chtc_logger_handle_duration_seconds", "histogram", "Time taken to handle each record, including collecting its statistics.")
+	for i, bound := range handleDurationBuckets {
+		fmt.Fprintf(out, "chtc_logger_handle_duration_seconds_bucket{le=%q} %d\n", formatFloat(bound), m.durationBuckets[i])
+	}
+	fmt.Fprintf(out, "chtc_logger_handle_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+	fmt.Fprintf(out, "chtc_logger_handle_duration_seconds_sum %s\n", formatFloat(m.durationSum))
+	fmt.Fprintf(out, "chtc_logger_handle_duration_seconds_count %d\n", m.durationCount)
+
+	if m.diskAvail != nil {
+		family("chtc_logger_disk_available_bytes", "gauge", "Storage space remaining on the file outputs' devices (the least, if there are several).")
+		fmt.Fprintf(out, "chtc_logger_disk_available_bytes %s\n", formatFloat(*m.diskAvail))
+	}
+	if m.healthCheckLag != nil {
+		family("chtc_logger_health_check_lag_seconds", "gauge", "Age of the latest heartbeat received by the health check backend.")
+		fmt.Fprintf(out, "chtc_logger_health_check_lag_seconds %s\n", formatFloat(*m.healthCheckLag))
+	}
+	if len(m.queueDepth) > 0 {
+		family("chtc_logger_queue_depth", "gauge", "Records queued for delivery by each batching output.")
+		for _, output := range sortedKeys(m.queueDepth, func(a, b string) bool { return a < b }) {
+			fmt.Fprintf(out, "chtc_logger_queue_depth{output=%s} %s\n", quoteLabel(output), formatFloat(m.queueDepth[output]))
+		}
+	}
+
+	if err := out.w.Flush(); err != nil {
+		return out.n, err
+	}
+	return out.n, out.err
+}
+
+// Buffered writer that counts the bytes written, keeping the first error
+type countingBufWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingBufWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, less func(a, b K) bool) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+// quoteLabel quotes a label value, escaping it as the Prometheus text format requires
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// startMetrics records the logger's metrics in the given registry, or in a new one if
+// none is given and the admin listener is configured to serve it, and starts the admin
+// listener. An admin listener of a logger being replaced on the same address is taken
+// over rather than started again, so that the address is never left unserved
+func startMetrics(log *slog.Logger, metricsCfg config.MetricsConfig, metrics *Metrics, previous *adminServer) error {
+	statHandler, ok := log.Handler().(*logDispatchStatHandler)
+	if !ok {
+		return nil
+	}
+	listen := metricsCfg.Enabled && metricsCfg.ListenAddress != ""
+	if metrics == nil && listen {
+		metrics = NewMetrics()
+	}
+	if metrics == nil {
+		return nil
+	}
+	statHandler.metrics = metrics
+	if !listen {
+		return nil
+	}
+
+	if previous != nil && !previous.closed.Load() && previous.listenAddress == metricsCfg.ListenAddress {
+		previous.serve(metricsCfg, metrics, statHandler)
+		statHandler.admin = previous
+		return nil
+	}
+	admin, err := startAdminServer(metricsCfg, metrics, statHandler)
+	if err != nil {
+		return err
+	}
+	statHandler.admin = admin
+	return nil
+}
+
+// Admin HTTP listener serving a logger's metrics and health
+type adminServer struct {
+	listenAddress string
+	server        *http.Server
+	addr          net.Addr
+	// Routes of the logger currently served, swapped when the listener is taken over
+	mux    atomic.Pointer[http.ServeMux]
+	closed atomic.Bool
+	once   sync.Once
+}
+
+// startAdminServer listens on the configured address, serving the metrics on the
+// configured path and the logger's health on /healthz
+func startAdminServer(metricsCfg config.MetricsConfig, metrics *Metrics, statHandler HealthReporter) (*adminServer, error) {
+	listener, err := net.Listen("tcp", metricsCfg.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start admin listener: %w", err)
+	}
+
+	admin := &adminServer{listenAddress: metricsCfg.ListenAddress, addr: listener.Addr()}
+	admin.serve(metricsCfg, metrics, statHandler)
+	admin.server = &http.Server{
+		Handler:           http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { admin.mux.Load().ServeHTTP(w, r) }),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go admin.server.Serve(listener)
+	return admin, nil
+}
+
+// serve directs the listener's requests to the given metrics and health
+func (a *adminServer) serve(metricsCfg config.MetricsConfig, metrics *Metrics, statHandler HealthReporter) {
+	mux := http.NewServeMux()
+	mux.Handle(metricsCfg.Path, metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := statHandler.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+	a.mux.Store(mux)
+}
+
+// Close stops the listener
+func (a *adminServer) Close() error {
+	if a == nil {
+		return nil
+	}
+	var err error
+	a.once.Do(func() {
+		a.closed.Store(true)
+		if closeErr := a.server.Close(); closeErr != nil && !errors.Is(closeErr, http.ErrServerClosed) {
+			err = closeErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,190 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package logger
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Ensure that a registry passed with WithMetrics counts records by level and output,
+// errors by output and Handle durations, and serves them in the Prometheus text format
+func TestMetrics(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	metrics := NewMetrics()
+	log, err := New(
+		WithConfig(&config.Config{FileOutput: config.FileOutputConfig{FilePath: path.Join(t.TempDir(), "app.log")}}),
+		WithConsole(false),
+		WithOutput("flaky", flakyHandler{Handler: slog.NewTextHandler(io.Discard, nil), failing: &failing}),
+		WithMetrics(metrics),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create logger: %v", err)
+	}
+	defer log.Handler().(io.Closer).Close()
+
+	log.Info("first")
+	log.Warn("second")
+	log.Debug("filtered")
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE chtc_logger_records_total counter\n",
+		`chtc_logger_records_total{level="INFO",output="file_output"} 1`,
+		`chtc_logger_records_total{level="WARN",output="flaky"} 1`,
+		`chtc_logger_output_errors_total{output="flaky"} 2`,
+		"# TYPE chtc_logger_handle_duration_seconds histogram\n",
+		`chtc_logger_handle_duration_seconds_bucket{le="+Inf"} 2`,
+		"chtc_logger_handle_duration_seconds_count 2\n",
+		"chtc_logger_disk_available_bytes ",
+	} {
+		if !strings.Contains(exposition, expected) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", expected, exposition)
+		}
+	}
+	if strings.Contains(exposition, "health_check_lag") || strings.Contains(exposition, "DEBUG") {
+		t.Errorf("Expected no health check lag or filtered records, got:\n%s", exposition)
+	}
+}
+
+// Ensure that the admin listener serves the metrics and the logger's health
+func TestMetricsAdminListener(t *testing.T) {
+	var failing atomic.Bool
+	log, err := New(
+		WithConsole(false),
+		WithFileOutput(false),
+		WithOutput("flaky", flakyHandler{Handler: slog.NewTextHandler(io.Discard, nil), failing: &failing}),
+		WithOverride(func(cfg *config.Config) {
+			cfg.Metrics = config.MetricsConfig{Enabled: true, ListenAddress: "127.0.0.1:0", Path: "/metrics"}
+			cfg.HealthCheck.MaxConsecutiveErrors = 1
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create logger: %v", err)
+	}
+	statHandler := log.Handler().(*logDispatchStatHandler)
+	baseURL := "http://" + statHandler.admin.addr.String()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		res, err := http.Get(baseURL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	log.Info("served")
+	if status, body := get("/metrics"); status != http.StatusOK || !strings.Contains(body, `chtc_logger_records_total{level="INFO",output="flaky"} 1`) {
+		t.Errorf("Expected the metrics to be served, got %d:\n%s", status, body)
+	}
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Errorf("Expected the logger to be healthy, got %d", status)
+	}
+	failing.Store(true)
+	log.Info("failed")
+	if status, body := get("/healthz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "output flaky") {
+		t.Errorf("Expected the failing output to be reported, got %d: %s", status, body)
+	}
+
+	statHandler.Close()
+	if _, err := http.Get(baseURL + "/metrics"); err == nil {
+		t.Errorf("Expected the admin listener to be closed with the logger")
+	}
+}
+
+// Ensure that metrics are only recorded where they can be read, and that Init hands
+// the admin listener over to the replacing logger, leaving the old logger in place
+// if the new one cannot start its listener
+func TestMetricsInitListener(t *testing.T) {
+	unserved, err := New(WithConsole(false), WithFileOutput(false), WithOverride(func(cfg *config.Config) {
+		cfg.Metrics = config.MetricsConfig{Enabled: true, Path: "/metrics"}
+	}))
+	if err != nil {
+		t.Fatalf("Unable to create logger: %v", err)
+	}
+	defer unserved.Handler().(io.Closer).Close()
+	if metrics := unserved.Handler().(*logDispatchStatHandler).metrics; metrics != nil {
+		t.Errorf("Expected no metrics to be recorded without a listener or registry")
+	}
+
+	initWith := func(label, listenAddress string) error {
+		return Init(
+			WithConsole(false),
+			WithFileOutput(false),
+			WithOutput(label, slog.NewTextHandler(io.Discard, nil)),
+			WithOverride(func(cfg *config.Config) {
+				cfg.Metrics = config.MetricsConfig{Enabled: true, ListenAddress: listenAddress, Path: "/metrics"}
+			}),
+		)
+	}
+	if err := initWith("first", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Unable to initialize logger: %v", err)
+	}
+	baseURL := "http://" + log.Handler().(*logDispatchStatHandler).admin.addr.String()
+	getMetrics := func() string {
+		t.Helper()
+		res, err := http.Get(baseURL + "/metrics")
+		if err != nil {
+			t.Fatalf("Failed to get the metrics: %v", err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body)
+	}
+
+	if err := initWith("second", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Unable to reinitialize logger: %v", err)
+	}
+	log.Info("served")
+	if body := getMetrics(); !strings.Contains(body, `output="second"`) {
+		t.Errorf("Expected the listener to serve the replacing logger's metrics, got:\n%s", body)
+	}
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer taken.Close()
+	current := log
+	if err := initWith("third", taken.Addr().String()); err == nil {
+		t.Fatalf("Expected an error starting the listener on a taken address")
+	}
+	if log != current {
+		t.Errorf("Expected the logger to be kept when its replacement fails")
+	}
+	log.Info("still served")
+	if body := getMetrics(); !strings.Contains(body, `chtc_logger_records_total{level="INFO",output="second"} 2`) {
+		t.Errorf("Expected the kept logger to still be served, got:\n%s", body)
+	}
+	log.Handler().(io.Closer).Close()
+}
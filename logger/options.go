@@ -0,0 +1,146 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/chtc/chtc-go-logger/config"
+	handler "github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Option configures a logger created by New or Init
+type Option func(*options)
+
+// Settings gathered from the Options passed to New or Init
+type options struct {
+	configFile  string
+	overrides   *config.Config
+	loadOptions []config.LoadOption
+	handlers    []handler.NamedHandler
+	ctx         context.Context
+	// Called whenever the health check state changes
+	healthCallback HealthCallback
+	// Registry to record the logger's metrics in
+	metrics *Metrics
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) loadConfig() (*config.Config, error) {
+	return config.LoadConfig(o.configFile, o.overrides, o.loadOptions...)
+}
+
+// WithConfigFile loads settings from the given config file, over the defaults
+func WithConfigFile(path string) Option {
+	return func(o *options) { o.configFile = path }
+}
+
+// WithConfig overrides the loaded configuration with the non-zero fields of cfg.
+// Use WithOverride or the options such as WithConsole to set false or zero values
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) { o.overrides = cfg }
+}
+
+// WithOutput sends records to h alongside the configured outputs. The label
+// identifies h in LogStats, so must differ from those of the other outputs
+func WithOutput(label string, h slog.Handler) Option {
+	return withHandlers(handler.NamedHandler{Handler: h, HandlerType: label})
+}
+
+func withHandlers(handlers ...handler.NamedHandler) Option {
+	return func(o *options) { o.handlers = append(o.handlers, handlers...) }
+}
+
+// WithLevel sets the minimum level of records logged by outputs without a level of their own
+func WithLevel(level slog.Level) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.LogLevel = level.String() })
+}
+
+// WithContext bounds the lifetime of the logger's background work by ctx
+func WithContext(ctx context.Context) Option {
+	return func(o *options) { o.ctx = ctx }
+}
+
+// WithOverride applies fn to the loaded configuration, after the config file,
+// environment variables and WithConfig overrides. fn may set fields to false or
+// zero, which WithConfig cannot
+func WithOverride(fn func(*config.Config)) Option {
+	return WithLoadOptions(config.Override(fn))
+}
+
+// WithLoadOptions passes options such as config.Layers or config.RecordProvenance to config.LoadConfig
+func WithLoadOptions(loadOptions ...config.LoadOption) Option {
+	return func(o *options) { o.loadOptions = append(o.loadOptions, loadOptions...) }
+}
+
+// WithConsole enables or disables the console output
+func WithConsole(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.ConsoleOutput.Enabled = enabled })
+}
+
+// WithFileOutput enables or disables the file output
+func WithFileOutput(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.FileOutput.Enabled = enabled })
+}
+
+// WithSyslog enables or disables the syslog output
+func WithSyslog(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.SyslogOutput.Enabled = enabled })
+}
+
+// WithJournald enables or disables the journald output
+func WithJournald(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.JournaldOutput.Enabled = enabled })
+}
+
+// WithSequenceInfo enables or disables adding the logger ID and sequence number to records
+func WithSequenceInfo(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.SequenceInfo.Enabled = enabled })
+}
+
+// WithHealthCheck enables or disables the health check
+func WithHealthCheck(enabled bool) Option {
+	return WithOverride(func(cfg *config.Config) { cfg.HealthCheck.Enabled = enabled })
+}
+
+// WithHealthCallback calls callback whenever the health check judges the logging
+// pipeline to have become healthy, degraded or down
+func WithHealthCallback(callback HealthCallback) Option {
+	return func(o *options) { o.healthCallback = callback }
+}
+
+// WithMetrics records the logger's metrics in the given registry, which the
+// application may serve alongside its own handlers, whether or not metrics are
+// enabled in the config
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *options) { o.metrics = metrics }
+}
+
+// WithStrictConfig rejects unknown keys in the config file and environment variables
+func WithStrictConfig() Option {
+	return WithLoadOptions(config.Strict())
+}
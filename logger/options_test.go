@@ -0,0 +1,123 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package logger
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+func handlerLabels(t *testing.T, params ...interface{}) []string {
+	log, err := NewLogger(params...)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	t.Cleanup(func() { log.Handler().(io.Closer).Close() })
+	var labels []string
+	for _, h := range log.Handler().(*logDispatchStatHandler).handlers {
+		labels = append(labels, h.HandlerType)
+	}
+	return labels
+}
+
+// Ensure that each output enabled by default can be disabled programmatically
+func TestDisableDefaultOutputs(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "app.log")
+	overrides := config.Config{FileOutput: config.FileOutputConfig{FilePath: logPath}}
+
+	if labels := handlerLabels(t, overrides); !reflect.DeepEqual(labels, []string{"console_output", "file_output"}) {
+		t.Fatalf("expected the console and file outputs to be enabled by default, got %v", labels)
+	}
+	if labels := handlerLabels(t, overrides, WithConsole(false)); !reflect.DeepEqual(labels, []string{"file_output"}) {
+		t.Fatalf("expected only the file output once the console is disabled, got %v", labels)
+	}
+	if labels := handlerLabels(t, overrides, WithFileOutput(false)); !reflect.DeepEqual(labels, []string{"console_output"}) {
+		t.Fatalf("expected only the console output once the file output is disabled, got %v", labels)
+	}
+
+	// Sequence info is also enabled by default
+	log, err := NewLogger(overrides, WithConsole(false), WithSequenceInfo(false))
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	log.Info("job submitted")
+	log.Handler().(io.Closer).Close()
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "job submitted") || strings.Contains(string(content), "sequence_no") {
+		t.Fatalf("expected a record without sequence info, got %s", content)
+	}
+}
+
+// Ensure that overrides can set zero values, and are applied after *config.Config overrides
+func TestZeroValueOverride(t *testing.T) {
+	cfg, err := config.LoadConfig("", &config.Config{LogLevel: "DEBUG"}, config.Override(func(cfg *config.Config) {
+		cfg.FileOutput.MaxBackups = 0
+		cfg.LogLevel = "WARN"
+	}))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.FileOutput.MaxBackups != 0 || cfg.LogLevel != "WARN" {
+		t.Fatalf("expected the override to set max_backups to 0 and log_level to WARN, got %v and %v", cfg.FileOutput.MaxBackups, cfg.LogLevel)
+	}
+}
+
+// Ensure that New applies each of its options, with log_level setting the minimum
+// level of the configured outputs but not of outputs with their own level
+func TestNew(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "app.log")
+	var captured bytes.Buffer
+	log, err := New(
+		WithConfig(&config.Config{FileOutput: config.FileOutputConfig{FilePath: logPath}}),
+		WithConsole(false),
+		WithLevel(slog.LevelWarn),
+		WithOutput("capture", slog.NewJSONHandler(&captured, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	log.Debug("polling schedd")
+	log.Warn("disk almost full")
+	log.Handler().(io.Closer).Close()
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	if strings.Count(string(content), "\n") != 1 || !strings.Contains(string(content), "disk almost full") {
+		t.Errorf("expected only the warning in the log file, got %s", content)
+	}
+	if strings.Count(captured.String(), "\n") != 2 {
+		t.Errorf("expected both records in the injected output, got %s", captured.String())
+	}
+
+	if _, err := New(WithConfigFile(path.Join(t.TempDir(), "missing.yaml"))); err == nil {
+		t.Errorf("expected an error for a missing config file")
+	}
+}
@@ -0,0 +1,271 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/chtc/chtc-go-logger/config"
+	handler "github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Function that constructs the handler for one entry in the config's outputs list.
+// cfg is the complete logger configuration, for factories that need shared settings
+// such as the service description
+type OutputFactory func(output config.OutputConfig, cfg *config.Config) (slog.Handler, error)
+
+var (
+	outputsMu sync.RWMutex
+	outputs   = map[string]OutputFactory{}
+
+	// Defaults for the built-in output types, from the matching *_output sections of default.yaml
+	outputDefaults = sync.OnceValues(config.DefaultConfig)
+)
+
+func init() {
+	registerBuiltinOutput("console", func(d *config.Config) config.ConsoleOutputConfig { return d.ConsoleOutput },
+		func(c config.ConsoleOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return newConsoleOutput(c, opts), nil
+		})
+	registerBuiltinOutput("file", func(d *config.Config) config.FileOutputConfig { return d.FileOutput },
+		func(c config.FileOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return newFileOutput(c, opts)
+		})
+	registerBuiltinOutput("syslog", func(d *config.Config) config.SyslogOutputConfig { return d.SyslogOutput },
+		func(c config.SyslogOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return newSyslogOutput(c, opts)
+		})
+	registerBuiltinOutput("journald", func(d *config.Config) config.JournaldOutputConfig { return d.JournaldOutput },
+		func(c config.JournaldOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return newJournaldOutput(c, opts)
+		})
+	registerBuiltinOutput("network", func(d *config.Config) config.NetworkOutputConfig { return d.NetworkOutput },
+		func(c config.NetworkOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return handler.NewNetworkHandler(c, jsonSupplier(opts))
+		})
+	registerBuiltinOutput("fluentd", func(d *config.Config) config.FluentdOutputConfig { return d.FluentdOutput },
+		func(c config.FluentdOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return handler.NewFluentdHandler(c, jsonSupplier(opts))
+		})
+	registerBuiltinOutput("elasticsearch", func(d *config.Config) config.ElasticsearchOutputConfig { return d.ElasticsearchOutput },
+		func(c config.ElasticsearchOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return handler.NewElasticsearchHandler(c, jsonSupplier(opts))
+		})
+	registerBuiltinOutput("otlp", func(d *config.Config) config.OTLPOutputConfig { return d.OTLPOutput },
+		func(c config.OTLPOutputConfig, cfg *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return handler.NewOTLPHandler(c, cfg.Service, opts)
+		})
+	registerBuiltinOutput("http", func(d *config.Config) config.HTTPOutputConfig { return d.HTTPOutput },
+		func(c config.HTTPOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return handler.NewHTTPHandler(c, jsonSupplier(opts))
+		})
+	registerBuiltinOutput("queue", func(d *config.Config) config.QueueOutputConfig { return d.QueueOutput },
+		func(c config.QueueOutputConfig, _ *config.Config, opts *slog.HandlerOptions) (slog.Handler, error) {
+			return newQueueOutput(c, opts)
+		})
+}
+
+// RegisterOutput makes an output type available to the outputs list of the logger
+// config under the given name, replacing any existing output with that name.
+// Handlers created this way are wrapped like the built-in outputs, so their errors
+// are attributed to them in LogStats
+func RegisterOutput(name string, factory OutputFactory) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+	outputs[name] = factory
+}
+
+func lookupOutput(name string) (OutputFactory, bool) {
+	outputsMu.RLock()
+	defer outputsMu.RUnlock()
+	factory, ok := outputs[name]
+	return factory, ok
+}
+
+// registerBuiltinOutput registers an output type whose settings are those of one of
+// the config's *_output sections, starting from that section's defaults
+func registerBuiltinOutput[T any](name string, defaults func(*config.Config) T,
+	build func(settings T, cfg *config.Config, opts *slog.HandlerOptions) (slog.Handler, error)) {
+	RegisterOutput(name, func(output config.OutputConfig, cfg *config.Config) (slog.Handler, error) {
+		defaultCfg, err := outputDefaults()
+		if err != nil {
+			return nil, err
+		}
+		settings := defaults(defaultCfg)
+		if err := output.DecodeSettings(&settings); err != nil {
+			return nil, err
+		}
+		opts, err := OutputHandlerOptions(output)
+		if err != nil {
+			return nil, err
+		}
+		if opts == nil {
+			// Outputs without a level of their own use the config's log_level
+			if opts, err = levelOptions(cfg.LogLevel); err != nil {
+				return nil, fmt.Errorf("invalid log_level: %w", err)
+			}
+		}
+		return build(settings, cfg, opts)
+	})
+}
+
+// OutputHandlerOptions returns the slog handler options for an entry in the config's
+// outputs list, for factories to pass along to the handlers they construct
+func OutputHandlerOptions(output config.OutputConfig) (*slog.HandlerOptions, error) {
+	opts, err := levelOptions(output.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid level for %s output: %w", output.Type, err)
+	}
+	return opts, nil
+}
+
+// levelOptions returns slog handler options with the given minimum level, or nil if level is empty
+func levelOptions(level string) (*slog.HandlerOptions, error) {
+	if level == "" {
+		return nil, nil
+	}
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	return &slog.HandlerOptions{Level: minLevel}, nil
+}
+
+// createOutputs constructs a handler for each entry in the config's outputs list,
+// adding each entry's route to routeCfgs under its label
+func createOutputs(cfg *config.Config, routeCfgs map[string]config.RouteConfig) ([]handler.NamedHandler, error) {
+	var handlers []handler.NamedHandler
+	for i, output := range cfg.Outputs {
+		factory, ok := lookupOutput(output.Type)
+		if !ok {
+			closeHandlers(handlers)
+			return nil, fmt.Errorf("outputs[%d]: unknown output type %q", i, output.Type)
+		}
+		h, err := factory(output, cfg)
+		if err != nil {
+			closeHandlers(handlers)
+			return nil, fmt.Errorf("outputs[%d]: failed to create %s output: %w", i, output.Type, err)
+		}
+
+		label := output.Label
+		if label == "" {
+			label = output.Type
+		}
+		handlers = append(handlers, handler.NamedHandler{Handler: h, HandlerType: label})
+		routeCfgs[label] = output.Route
+	}
+	return handlers, nil
+}
+
+// fileOutputPaths returns the path of every enabled file output in the config,
+// including file entries in the outputs list
+func fileOutputPaths(cfg config.Config) []string {
+	var paths []string
+	if cfg.FileOutput.Enabled {
+		paths = append(paths, cfg.FileOutput.FilePath)
+	}
+	for _, output := range cfg.Outputs {
+		if output.Type != "file" {
+			continue
+		}
+		settings := config.FileOutputConfig{}
+		if defaultCfg, err := outputDefaults(); err == nil {
+			settings = defaultCfg.FileOutput
+		}
+		if err := output.DecodeSettings(&settings); err == nil {
+			paths = append(paths, settings.FilePath)
+		}
+	}
+	return paths
+}
+
+// jsonSupplier supplies the JSON handler that formats records for the network-based outputs
+func jsonSupplier(opts *slog.HandlerOptions) handler.HandlerSupplier {
+	return func(w io.Writer) slog.Handler {
+		return slog.NewJSONHandler(w, opts)
+	}
+}
+
+func newConsoleOutput(consoleCfg config.ConsoleOutputConfig, opts *slog.HandlerOptions) slog.Handler {
+	out := handler.NewCountingWriter(os.Stdout)
+	if consoleCfg.JSONOutput {
+		return &countedHandler{Handler: slog.NewJSONHandler(out, opts), written: out}
+	} else if consoleCfg.Colors {
+		colorHandler := &ColorConsoleHandler{output: out}
+		if opts != nil {
+			colorHandler.level = opts.Level
+		}
+		return &countedHandler{Handler: colorHandler, written: out}
+	}
+	return &countedHandler{Handler: slog.NewTextHandler(out, opts), written: out}
+}
+
+// Handler that wraps another slog handler, reporting the bytes it writes through a CountingWriter
+type countedHandler struct {
+	slog.Handler
+	written *handler.CountingWriter
+}
+
+// Required by slog.Handler interface: Groups attributes under a namespace for the writing handler
+func (c *countedHandler) WithGroup(name string) slog.Handler {
+	return &countedHandler{Handler: c.Handler.WithGroup(name), written: c.written}
+}
+
+// Required by slog.Handler interface: Adds attributes to the writing handler
+func (c *countedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &countedHandler{Handler: c.Handler.WithAttrs(attrs), written: c.written}
+}
+
+// BytesWritten reports the number of bytes written by the wrapped handler
+func (c *countedHandler) BytesWritten() uint64 {
+	return c.written.BytesWritten()
+}
+
+func newFileOutput(fileCfg config.FileOutputConfig, opts *slog.HandlerOptions) (slog.Handler, error) {
+	return handler.NewFileHandler(fileCfg, jsonSupplier(opts))
+}
+
+func newSyslogOutput(syslogCfg config.SyslogOutputConfig, opts *slog.HandlerOptions) (slog.Handler, error) {
+	if syslogCfg.JSONOutput {
+		return handler.NewSyslogHandler(syslogCfg, jsonSupplier(opts))
+	}
+	return handler.NewSyslogHandler(syslogCfg, func(w io.Writer) slog.Handler {
+		return slog.NewTextHandler(w, opts)
+	})
+}
+
+func newJournaldOutput(journaldCfg config.JournaldOutputConfig, opts *slog.HandlerOptions) (slog.Handler, error) {
+	journaldOpts := &slog.HandlerOptions{AddSource: journaldCfg.AddSource}
+	if opts != nil {
+		journaldOpts.Level = opts.Level
+	}
+	return handler.NewJournaldHandler(journaldCfg, journaldOpts)
+}
+
+func newQueueOutput(queueCfg config.QueueOutputConfig, opts *slog.HandlerOptions) (slog.Handler, error) {
+	sink, err := handler.NewQueueSink(queueCfg)
+	if err != nil {
+		return nil, err
+	}
+	return handler.NewQueueHandler(queueCfg, sink, jsonSupplier(opts)), nil
+}
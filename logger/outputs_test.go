@@ -0,0 +1,238 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Handler that always fails, to check that errors are attributed to it
+type failingHandler struct {
+	slog.Handler
+}
+
+func (h failingHandler) Handle(ctx context.Context, r slog.Record) error {
+	return errors.New("output unavailable")
+}
+
+// Handler that records whether it has been closed
+type closingHandler struct {
+	slog.Handler
+	closed *atomic.Bool
+}
+
+func (h closingHandler) Close() error {
+	h.closed.Store(true)
+	return nil
+}
+
+// Ensure that outputs registered by type are created from the config's outputs
+// list with their settings, and that injected handlers receive records with
+// their errors attributed to them in LogStats
+func TestRegisteredAndInjectedOutputs(t *testing.T) {
+	var mu sync.Mutex
+	buffers := map[string]*bytes.Buffer{}
+	RegisterOutput("test_buffer", func(output config.OutputConfig, cfg *config.Config) (slog.Handler, error) {
+		settings := struct {
+			Name string         `mapstructure:"name"`
+			Tags map[string]any `mapstructure:"tags"`
+		}{}
+		if err := output.DecodeSettings(&settings); err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		buffers[settings.Name] = &bytes.Buffer{}
+		var h slog.Handler = slog.NewJSONHandler(buffers[settings.Name], nil)
+		for key, value := range settings.Tags {
+			h = h.WithAttrs([]slog.Attr{slog.Any(key, value)})
+		}
+		return h, nil
+	})
+
+	cfg := &config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(t.TempDir(), "app.log"),
+		},
+		Outputs: []config.OutputConfig{
+			{Type: "test_buffer", Settings: map[string]any{"name": "plain"}},
+			{Type: "test_buffer", Label: "tagged", Settings: map[string]any{"name": "tagged", "tags": map[string]any{"site": "chtc"}}},
+		},
+	}
+	injected := handlers.NamedHandler{
+		Handler:     failingHandler{slog.NewJSONHandler(&bytes.Buffer{}, nil)},
+		HandlerType: "injected_output",
+	}
+	contextLogger, err := NewContextAwareLogger(cfg, injected)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer contextLogger.Close()
+
+	var lastStats LogStats
+	contextLogger.SetErrorCallback(func(stats LogStats) {
+		lastStats = stats
+	})
+
+	contextLogger.Info(context.Background(), "informational message")
+	contextLogger.Error(context.Background(), "error message")
+
+	for _, name := range []string{"plain", "tagged"} {
+		if lines := strings.Count(buffers[name].String(), "\n"); lines != 2 {
+			t.Errorf("expected 2 records in the %s output, got %v", name, lines)
+		}
+	}
+	if strings.Count(buffers["tagged"].String(), `"site":"chtc"`) != 2 || strings.Contains(buffers["plain"].String(), "site") {
+		t.Errorf("expected only the tagged output to add its configured attributes, got %s", buffers["tagged"].String())
+	}
+	if len(lastStats.Errors) != 1 || lastStats.Errors[0].Handler.HandlerType != "injected_output" {
+		t.Fatalf("expected 1 error from injected_output, got %v", lastStats.Errors)
+	}
+}
+
+// Ensure that an outputs entry with an unregistered type is rejected
+func TestUnknownOutputType(t *testing.T) {
+	_, err := NewLogger(&config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(t.TempDir(), "app.log"),
+		},
+		Outputs: []config.OutputConfig{{Type: "no_such_output"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no_such_output") {
+		t.Fatalf("expected an error naming the unknown output type, got %v", err)
+	}
+}
+
+// Ensure that outputs already created are closed if a later output can't be,
+// while handlers passed in by the caller are left open
+func TestFailedOutputClosesCreated(t *testing.T) {
+	var created, injected atomic.Bool
+	RegisterOutput("test_closer", func(output config.OutputConfig, cfg *config.Config) (slog.Handler, error) {
+		return closingHandler{slog.NewJSONHandler(&bytes.Buffer{}, nil), &created}, nil
+	})
+
+	_, err := NewLogger(&config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(t.TempDir(), "app.log"),
+		},
+		Outputs: []config.OutputConfig{{Type: "test_closer"}, {Type: "no_such_output"}},
+	}, handlers.NamedHandler{
+		Handler:     closingHandler{slog.NewJSONHandler(&bytes.Buffer{}, nil), &injected},
+		HandlerType: "injected_output",
+	})
+	if err == nil {
+		t.Fatal("expected an error for the unknown output type")
+	}
+	if !created.Load() {
+		t.Error("expected the output created before the failure to be closed")
+	}
+	if injected.Load() {
+		t.Error("expected the injected handler to be left open")
+	}
+}
+
+// Ensure that several outputs of a built-in type can be configured in YAML, each
+// with its own label, level and settings, alongside the single file_output section
+func TestMultipleFileOutputs(t *testing.T) {
+	dir := t.TempDir()
+	configFile := path.Join(dir, "config.yaml")
+	yaml := `
+file_output:
+  file_path: ` + path.Join(dir, "app.log") + `
+outputs:
+  - type: file
+    label: audit_file
+    level: WARN
+    file_path: ` + path.Join(dir, "audit.log") + `
+    max_backups: 50
+  - type: file
+    label: debug_file
+    level: debug
+    file_path: ` + path.Join(dir, "debug.log") + `
+`
+	if err := os.WriteFile(configFile, []byte(yaml), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	contextLogger, err := NewContextAwareLogger(configFile)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer contextLogger.Close()
+
+	var lastStats LogStats
+	contextLogger.SetErrorCallback(func(stats LogStats) {
+		lastStats = stats
+	})
+
+	contextLogger.Debug(context.Background(), "debug message")
+	contextLogger.Info(context.Background(), "informational message")
+	contextLogger.Warn(context.Background(), "warning message")
+
+	expected := map[string][]string{
+		"app.log":   {"informational message", "warning message"},
+		"audit.log": {"warning message"},
+		"debug.log": {"debug message", "informational message", "warning message"},
+	}
+	for name, messages := range expected {
+		content, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if lines := strings.Count(string(content), "\n"); lines != len(messages) {
+			t.Errorf("expected %v records in %s, got %v", len(messages), name, lines)
+		}
+		for _, message := range messages {
+			if !strings.Contains(string(content), message) {
+				t.Errorf("expected %s to contain %q", name, message)
+			}
+		}
+	}
+	if lastStats.DiskAvail == 0 || len(lastStats.Errors) != 0 {
+		t.Errorf("expected disk usage of the file outputs without errors, got %+v", lastStats)
+	}
+}
+
+// Ensure that outputs sharing a label are rejected, so errors can always be attributed
+func TestDuplicateOutputLabels(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewLogger(&config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(dir, "app.log"),
+		},
+		Outputs: []config.OutputConfig{
+			{Type: "file", Settings: map[string]any{"file_path": path.Join(dir, "a.log")}},
+			{Type: "file", Settings: map[string]any{"file_path": path.Join(dir, "b.log")}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), `"file"`) {
+		t.Fatalf("expected an error naming the duplicated label, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chtc/chtc-go-logger/config"
+	"github.com/chtc/chtc-go-logger/logger/handlers"
+)
+
+// Compiled form of an output's route config
+type outputRoute struct {
+	include []routeRule
+	exclude []routeRule
+}
+
+type routeRule struct {
+	minLevel   *slog.Level
+	maxLevel   *slog.Level
+	message    *regexp.Regexp
+	attributes []attrMatch
+	group      string
+}
+
+// Condition that a record has an attribute, with a given value if hasValue is set
+type attrMatch struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// Record being routed, along with the group and attributes of the logger it came from
+type routedRecord struct {
+	record      slog.Record
+	group       string
+	loggerAttrs map[string]string
+	attrs       map[string]string
+}
+
+// WithRoute returns a child of the given logger whose records are sent only to the
+// outputs with the given labels, regardless of those outputs' route rules.
+// Returns an error naming any label that matches none of the logger's outputs
+func WithRoute(logger *slog.Logger, outputs ...string) (*slog.Logger, error) {
+	dispatcher, ok := logger.Handler().(*logDispatchStatHandler)
+	if !ok {
+		return nil, errors.New("logger does not support routing records to its outputs")
+	}
+	var unknown []string
+	for _, output := range outputs {
+		if !slices.ContainsFunc(dispatcher.handlers, func(h handlers.NamedHandler) bool { return h.HandlerType == output }) {
+			unknown = append(unknown, output)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("no output is labeled %s", strings.Join(unknown, ", "))
+	}
+	return slog.New(dispatcher.withRoute(outputs)), nil
+}
+
+// WithRoute returns a child of the logger whose records are sent only to the outputs
+// with the given labels, regardless of those outputs' route rules.
+// Returns an error naming any label that matches none of the logger's outputs
+func (l *ContextAwareLogger) WithRoute(outputs ...string) (*ContextAwareLogger, error) {
+	routed, err := WithRoute(l.logger, outputs...)
+	if err != nil {
+		return nil, err
+	}
+	return &ContextAwareLogger{logger: routed, statHandler: routed.Handler().(LogStatHandler)}, nil
+}
+
+// compileRoutes compiles the route config of each output, keyed by output label.
+// Outputs without any rules are left out
+func compileRoutes(routeCfgs map[string]config.RouteConfig) (map[string]*outputRoute, error) {
+	routes := map[string]*outputRoute{}
+	for label, routeCfg := range routeCfgs {
+		route, err := compileRoute(routeCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route for %s: %w", label, err)
+		}
+		if route != nil {
+			routes[label] = route
+		}
+	}
+	return routes, nil
+}
+
+func compileRoute(routeCfg config.RouteConfig) (*outputRoute, error) {
+	if len(routeCfg.Include) == 0 && len(routeCfg.Exclude) == 0 {
+		return nil, nil
+	}
+	route := &outputRoute{}
+	for i, ruleCfg := range routeCfg.Include {
+		rule, err := compileRouteRule(ruleCfg)
+		if err != nil {
+			return nil, fmt.Errorf("include[%d]: %w", i, err)
+		}
+		route.include = append(route.include, rule)
+	}
+	for i, ruleCfg := range routeCfg.Exclude {
+		rule, err := compileRouteRule(ruleCfg)
+		if err != nil {
+			return nil, fmt.Errorf("exclude[%d]: %w", i, err)
+		}
+		route.exclude = append(route.exclude, rule)
+	}
+	return route, nil
+}
+
+func compileRouteRule(ruleCfg config.RouteRule) (routeRule, error) {
+	rule := routeRule{group: ruleCfg.Group}
+	for _, level := range []struct {
+		text   string
+		target **slog.Level
+	}{{ruleCfg.MinLevel, &rule.minLevel}, {ruleCfg.MaxLevel, &rule.maxLevel}} {
+		if level.text == "" {
+			continue
+		}
+		parsed := new(slog.Level)
+		if err := parsed.UnmarshalText([]byte(level.text)); err != nil {
+			return rule, err
+		}
+		*level.target = parsed
+	}
+	if ruleCfg.Message != "" {
+		message, err := regexp.Compile(ruleCfg.Message)
+		if err != nil {
+			return rule, fmt.Errorf("invalid message pattern: %w", err)
+		}
+		rule.message = message
+	}
+	for _, attr := range ruleCfg.Attributes {
+		key, value, hasValue := strings.Cut(attr, "=")
+		rule.attributes = append(rule.attributes, attrMatch{key: key, value: value, hasValue: hasValue})
+	}
+	return rule, nil
+}
+
+// allows reports whether a record should be sent to the route's output
+func (r *outputRoute) allows(rec *routedRecord) bool {
+	for _, rule := range r.exclude {
+		if rule.matches(rec) {
+			return false
+		}
+	}
+	if len(r.include) == 0 {
+		return true
+	}
+	for _, rule := range r.include {
+		if rule.matches(rec) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r routeRule) matches(rec *routedRecord) bool {
+	if r.minLevel != nil && rec.record.Level < *r.minLevel {
+		return false
+	}
+	if r.maxLevel != nil && rec.record.Level > *r.maxLevel {
+		return false
+	}
+	if r.message != nil && !r.message.MatchString(rec.record.Message) {
+		return false
+	}
+	if r.group != "" && rec.group != r.group && !strings.HasPrefix(rec.group, r.group+".") {
+		return false
+	}
+	if len(r.attributes) > 0 {
+		attrs := rec.allAttrs()
+		for _, match := range r.attributes {
+			value, ok := attrs[match.key]
+			if !ok || (match.hasValue && value != match.value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allAttrs returns the record's attributes merged with those of its logger, keyed
+// by their dotted path, computing them on first use
+func (rec *routedRecord) allAttrs() map[string]string {
+	if rec.attrs != nil {
+		return rec.attrs
+	}
+	rec.attrs = make(map[string]string, len(rec.loggerAttrs)+rec.record.NumAttrs())
+	for key, value := range rec.loggerAttrs {
+		rec.attrs[key] = value
+	}
+	rec.record.Attrs(func(attr slog.Attr) bool {
+		flattenAttr(rec.group, attr, rec.attrs)
+		return true
+	})
+	return rec.attrs
+}
+
+// flattenAttr adds an attribute to attrs under its dotted path, expanding groups
+func flattenAttr(prefix string, attr slog.Attr, attrs map[string]string) {
+	value := attr.Value.Resolve()
+	key := attr.Key
+	if prefix != "" && key != "" {
+		key = prefix + "." + key
+	} else if key == "" {
+		key = prefix
+	}
+	if value.Kind() == slog.KindGroup {
+		for _, member := range value.Group() {
+			flattenAttr(key, member, attrs)
+		}
+	} else if attr.Key != "" {
+		attrs[key] = value.String()
+	}
+}
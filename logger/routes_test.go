@@ -0,0 +1,112 @@
+/***************************************************************
+ *
+ * Copyright (C) 2025, Pelican Project, Morgridge Institute for Research
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you
+ * may not use this file except in compliance with the License.  You may
+ * obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ ***************************************************************/
+package logger
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/chtc/chtc-go-logger/config"
+)
+
+// Ensure that records are only sent to the outputs whose route rules allow them,
+// and that a routed child logger sends records only to the outputs it names,
+// which must exist
+func TestOutputRoutes(t *testing.T) {
+	dir := t.TempDir()
+	fileOutput := func(label string, route config.RouteConfig) config.OutputConfig {
+		return config.OutputConfig{
+			Type:     "file",
+			Label:    label,
+			Route:    route,
+			Settings: map[string]any{"file_path": path.Join(dir, label+".log")},
+		}
+	}
+	cfg := &config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(dir, "main.log"),
+			Route: config.RouteConfig{Exclude: []config.RouteRule{
+				{Attributes: []string{"audit"}},
+				{Attributes: []string{"component=poller"}},
+			}},
+		},
+		Outputs: []config.OutputConfig{
+			fileOutput("audit", config.RouteConfig{Include: []config.RouteRule{{Attributes: []string{"audit"}}}}),
+			fileOutput("disk_warnings", config.RouteConfig{Include: []config.RouteRule{{MinLevel: "WARN", MaxLevel: "WARN", Message: "^disk"}}}),
+			fileOutput("transfers", config.RouteConfig{Include: []config.RouteRule{{Group: "jobs", Attributes: []string{"jobs.transfer.id=5"}}}}),
+		},
+	}
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("failed to initialize logger: %v", err)
+	}
+	defer log.Handler().(io.Closer).Close()
+
+	log.Info("job submitted", "audit", true)
+	log.With("component", "poller").Info("polling schedd")
+	log.Warn("disk almost full")
+	log.Error("disk failed")
+	transferLog := log.WithGroup("jobs").WithGroup("transfer")
+	transferLog.Info("transfer started", "id", 5)
+	transferLog.Info("transfer started", "id", 6)
+	auditLog, err := WithRoute(log, "audit")
+	if err != nil {
+		t.Fatalf("failed to route logger: %v", err)
+	}
+	auditLog.Info("job removed")
+	if _, err := WithRoute(log, "audit", "adit"); err == nil || !strings.Contains(err.Error(), `adit`) {
+		t.Errorf("expected an error naming the unknown output label, got %v", err)
+	}
+
+	expected := map[string][]string{
+		"main.log":          {"disk almost full", "disk failed", "transfer started", "transfer started"},
+		"audit.log":         {"job submitted", "job removed"},
+		"disk_warnings.log": {"disk almost full"},
+		"transfers.log":     {`"id":5`},
+	}
+	for name, messages := range expected {
+		content, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if lines := strings.Count(string(content), "\n"); lines != len(messages) {
+			t.Errorf("expected %v records in %s, got %v:\n%s", len(messages), name, lines, content)
+		}
+		for _, message := range messages {
+			if !strings.Contains(string(content), message) {
+				t.Errorf("expected %s to contain %q", name, message)
+			}
+		}
+	}
+}
+
+// Ensure that invalid route rules are reported when creating the logger
+func TestInvalidRoute(t *testing.T) {
+	_, err := NewLogger(&config.Config{
+		FileOutput: config.FileOutputConfig{
+			FilePath: path.Join(t.TempDir(), "app.log"),
+			Route:    config.RouteConfig{Include: []config.RouteRule{{Message: "job ("}}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid message pattern") {
+		t.Fatalf("expected an error for the invalid message pattern, got %v", err)
+	}
+}